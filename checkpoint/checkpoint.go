@@ -0,0 +1,262 @@
+package checkpoint
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/oscar-martin/tail_folders/logger"
+)
+
+// fingerprintSize is the amount of bytes from the start of a file used for
+// telling apart files that reuse the same inode
+const fingerprintSize = 1024
+
+// Checkpoint models the position read so far in a file
+type Checkpoint struct {
+	// Path is the path of the file
+	Path string `json:"path"`
+	// Device is the identifier of the device containing the file
+	Device uint64 `json:"dev"`
+	// Inode is the inode of the file
+	Inode uint64 `json:"inode"`
+	// Fingerprint is a hash of the first FingerprintSize bytes of the file
+	Fingerprint string `json:"fingerprint"`
+	// FingerprintSize is the amount of bytes used for the Fingerprint
+	FingerprintSize int64 `json:"fingerprint_size"`
+	// Offset is the position in bytes where to resume reading
+	Offset int64 `json:"offset"`
+}
+
+// NewCheckpoint creates a Checkpoint for the open file at the given offset
+func NewCheckpoint(path string, file *os.File, offset int64) (Checkpoint, error) {
+	c := Checkpoint{Path: path}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return c, err
+	}
+	c.Device, c.Inode = FileID(fileInfo)
+	c.FingerprintSize = fileInfo.Size()
+	if c.FingerprintSize > fingerprintSize {
+		c.FingerprintSize = fingerprintSize
+	}
+	c.Fingerprint, err = fingerprint(file, c.FingerprintSize)
+	if err != nil {
+		return c, err
+	}
+	c.Offset = offset
+	return c, nil
+}
+
+// Update moves the checkpoint to offset. The fingerprint is refreshed while it
+// does not cover fingerprintSize bytes and the file has grown
+func (c *Checkpoint) Update(file *os.File, offset int64) error {
+	c.Offset = offset
+	if c.FingerprintSize >= fingerprintSize || offset <= c.FingerprintSize {
+		return nil
+	}
+	updated, err := NewCheckpoint(c.Path, file, offset)
+	if err != nil {
+		return err
+	}
+	*c = updated
+	return nil
+}
+
+// Matches tells whether the open file is the one the checkpoint was taken
+// from and whether it is still possible to resume reading from its offset
+func (c Checkpoint) Matches(file *os.File) bool {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	device, inode := FileID(fileInfo)
+	if device != c.Device || inode != c.Inode {
+		return false
+	}
+	if fileInfo.Size() < c.Offset || fileInfo.Size() < c.FingerprintSize {
+		return false
+	}
+	found, err := fingerprint(file, c.FingerprintSize)
+	if err != nil {
+		return false
+	}
+	return found == c.Fingerprint
+}
+
+func fingerprint(file *os.File, size int64) (string, error) {
+	buf := make([]byte, size)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	sum := sha1.Sum(buf[:n])
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Registry keeps the checkpoints of the files being tailed and persists them
+// periodically into a file, so tailing can be resumed after a restart
+type Registry struct {
+	mutex       sync.Mutex
+	filename    string
+	checkpoints map[string]Checkpoint
+	dirty       bool
+	stopChan    chan struct{}
+	doneChan    chan struct{}
+}
+
+// Load creates a Registry with the checkpoints persisted in filename. A missing
+// file leads to an empty registry. Checkpoints of files that do not exist any
+// more are discarded
+func Load(filename string) (*Registry, error) {
+	r := &Registry{
+		filename:    filename,
+		checkpoints: make(map[string]Checkpoint),
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints []Checkpoint
+	if err := json.Unmarshal(content, &checkpoints); err != nil {
+		return nil, err
+	}
+	for _, c := range checkpoints {
+		if _, err := os.Stat(c.Path); err != nil {
+			logger.Info.Printf("Discarding checkpoint for '%s': %v\n", c.Path, err)
+			r.dirty = true
+			continue
+		}
+		r.checkpoints[c.Path] = c
+	}
+	return r, nil
+}
+
+// Get returns the checkpoint stored for path
+func (r *Registry) Get(path string) (Checkpoint, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	c, ok := r.checkpoints[path]
+	return c, ok
+}
+
+// Set stores the checkpoint, replacing any previous one for its path
+func (r *Registry) Set(c Checkpoint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if previous, ok := r.checkpoints[c.Path]; ok && previous == c {
+		return
+	}
+	r.checkpoints[c.Path] = c
+	r.dirty = true
+}
+
+// Remove discards the checkpoint stored for path
+func (r *Registry) Remove(path string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.checkpoints[path]; ok {
+		delete(r.checkpoints, path)
+		r.dirty = true
+	}
+}
+
+// Save persists the checkpoints if there are changes since last save.
+// The file is replaced atomically, so a crash never leaves it half-written
+func (r *Registry) Save() error {
+	r.mutex.Lock()
+	if !r.dirty {
+		r.mutex.Unlock()
+		return nil
+	}
+	checkpoints := make([]Checkpoint, 0, len(r.checkpoints))
+	for _, c := range r.checkpoints {
+		checkpoints = append(checkpoints, c)
+	}
+	r.dirty = false
+	r.mutex.Unlock()
+
+	content, err := json.Marshal(checkpoints)
+	if err != nil {
+		r.markDirty()
+		return err
+	}
+	if err := writeFileAtomically(r.filename, content); err != nil {
+		r.markDirty()
+		return err
+	}
+	return nil
+}
+
+func (r *Registry) markDirty() {
+	r.mutex.Lock()
+	r.dirty = true
+	r.mutex.Unlock()
+}
+
+// Start persists the checkpoints every interval till Close is called. When
+// interval is not positive, they are only persisted by Close
+func (r *Registry) Start(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	r.stopChan = make(chan struct{})
+	r.doneChan = make(chan struct{})
+	go func() {
+		defer close(r.doneChan)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.Save(); err != nil {
+					logger.Error.Printf("Unable to save checkpoints into '%s': %v\n", r.filename, err)
+				}
+			case <-r.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops persisting periodically and saves the checkpoints one last time
+func (r *Registry) Close() error {
+	if r.stopChan != nil {
+		close(r.stopChan)
+		<-r.doneChan
+		r.stopChan = nil
+	}
+	return r.Save()
+}
+
+func writeFileAtomically(filename string, content []byte) error {
+	tmpFile, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
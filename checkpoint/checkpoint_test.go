@@ -0,0 +1,96 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createFile(t *testing.T, dir, name, content string) *os.File {
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestRegistrySaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := createFile(t, dir, "app.log", "one\ntwo\n")
+	defer file.Close()
+	c, err := NewCheckpoint(file.Name(), file, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registryFile := filepath.Join(dir, "registry.json")
+	registry, err := Load(registryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// not positive intervals persist checkpoints on Close only
+	registry.Start(0)
+	registry.Set(c)
+	registry.Set(Checkpoint{Path: filepath.Join(dir, "removed.log")})
+	if err := registry.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(registryFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, ok := loaded.Get(file.Name())
+	if !ok || found != c {
+		t.Errorf("Found: %v; wanted: %v", found, c)
+	}
+	if _, ok := loaded.Get(filepath.Join(dir, "removed.log")); ok {
+		t.Error("Checkpoint of a missing file should be discarded")
+	}
+}
+
+func TestCheckpointMatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := createFile(t, dir, "app.log", "one\n")
+	defer file.Close()
+	c, err := NewCheckpoint(file.Name(), file, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// growing the file keeps it matching
+	if _, err := file.Write([]byte("two\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Matches(file) {
+		t.Error("Checkpoint should match the file it was taken from")
+	}
+
+	// rewriting the start of the file does not
+	if _, err := file.WriteAt([]byte("ONE\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if c.Matches(file) {
+		t.Error("Checkpoint should not match a file with a different fingerprint")
+	}
+
+	other := createFile(t, dir, "other.log", "one\ntwo\n")
+	defer other.Close()
+	if c.Matches(other) {
+		t.Error("Checkpoint should not match a different file")
+	}
+}
@@ -0,0 +1,339 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/oscar-martin/tail_folders/tail"
+)
+
+// Compile turns a filter expression into a function telling whether an entry
+// matches it. Expressions combine predicates with 'and', 'or', 'not' (or '&&',
+// '||', '!') and parentheses. A predicate is either:
+//
+//   - a quoted text, which matches entries whose message contains it
+//   - SUBJECT OPERATOR VALUE, where SUBJECT is 'msg' (or 'message') for the
+//     message, 'level' for the detected level, 'file' for the filename or the
+//     name of a parsed field or a label, and OPERATOR is one of 'contains',
+//     'icontains', 'matches', 'imatches', '==', '!=', '<', '<=', '>' or '>='
+//
+// Comparisons are numeric when both sides are numbers or durations, follow
+// the severity order for levels and are lexicographic otherwise. Predicates on
+// missing fields are false
+func Compile(expression string) (func(tail.Entry) bool, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("Unexpected '%s' in filter expression", p.peek().text)
+	}
+	return f, nil
+}
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	stringToken
+	symbolToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var symbols = []string{"&&", "||", "==", "!=", "<=", ">=", "(", ")", "!", "<", ">"}
+
+func tokenize(expression string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(expression); {
+		c := expression[i]
+		if unicode.IsSpace(rune(c)) {
+			i++
+			continue
+		}
+		if c == '"' {
+			end := i + 1
+			for end < len(expression) && expression[end] != '"' {
+				if expression[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expression) {
+				return nil, fmt.Errorf("Unterminated string in filter expression: %s", expression[i:])
+			}
+			text, err := strconv.Unquote(expression[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("Wrong string in filter expression: %s", expression[i:end+1])
+			}
+			tokens = append(tokens, token{kind: stringToken, text: text})
+			i = end + 1
+			continue
+		}
+		symbol := ""
+		for _, s := range symbols {
+			if strings.HasPrefix(expression[i:], s) {
+				symbol = s
+				break
+			}
+		}
+		if symbol != "" {
+			tokens = append(tokens, token{kind: symbolToken, text: symbol})
+			i += len(symbol)
+			continue
+		}
+		end := i
+		for end < len(expression) && !unicode.IsSpace(rune(expression[end])) && !strings.ContainsRune(`"()!=<>&|`, rune(expression[end])) {
+			end++
+		}
+		if end == i {
+			return nil, fmt.Errorf("Unexpected '%c' in filter expression", c)
+		}
+		tokens = append(tokens, token{kind: wordToken, text: expression[i:end]})
+		i = end
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() (token, error) {
+	if p.done() {
+		return token{}, fmt.Errorf("Unexpected end of filter expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+// accept consumes the next token if it is one of the keywords or symbols
+func (p *parser) accept(keywords ...string) bool {
+	t := p.peek()
+	if p.done() || t.kind == stringToken {
+		return false
+	}
+	for _, keyword := range keywords {
+		if strings.EqualFold(t.text, keyword) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) parseOr() (func(tail.Entry) bool, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e tail.Entry) bool { return l(e) || right(e) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (func(tail.Entry) bool, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and", "&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e tail.Entry) bool { return l(e) && right(e) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (func(tail.Entry) bool, error) {
+	if p.accept("not", "!") {
+		f, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(e tail.Entry) bool { return !f(e) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (func(tail.Entry) bool, error) {
+	if p.accept("(") {
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("Missing ')' in filter expression")
+		}
+		return f, nil
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == stringToken {
+		text := t.text
+		return func(e tail.Entry) bool { return strings.Contains(e.Message, text) }, nil
+	}
+	if t.kind != wordToken {
+		return nil, fmt.Errorf("Unexpected '%s' in filter expression", t.text)
+	}
+	subject := t.text
+
+	operator, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if value.kind == symbolToken {
+		return nil, fmt.Errorf("Unexpected '%s' in filter expression", value.text)
+	}
+	return predicate(subject, strings.ToLower(operator.text), value.text)
+}
+
+// subjectValue returns the value of the subject in the entry, if it has it
+func subjectValue(e tail.Entry, subject string) (string, bool) {
+	switch subject {
+	case "msg", "message":
+		return e.Message, true
+	case "level":
+		return e.Level, e.Level != ""
+	case "file":
+		return e.Filename, true
+	default:
+		if value, ok := e.FieldValue(subject); ok {
+			return value, true
+		}
+		value, ok := e.Labels[subject]
+		return value, ok
+	}
+}
+
+func predicate(subject string, operator string, value string) (func(tail.Entry) bool, error) {
+	var match func(string) bool
+	switch operator {
+	case "contains":
+		match = func(s string) bool { return strings.Contains(s, value) }
+	case "icontains":
+		lowerValue := strings.ToLower(value)
+		match = func(s string) bool { return strings.Contains(strings.ToLower(s), lowerValue) }
+	case "matches", "imatches":
+		pattern := value
+		if operator == "imatches" {
+			pattern = "(?i)" + pattern
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Regex '%s' in filter expression is not right: %v", value, err)
+		}
+		match = regex.MatchString
+	case "==", "!=", "<", "<=", ">", ">=":
+		compareToValue := comparator(subject, value)
+		match = func(s string) bool {
+			c := compareToValue(s)
+			switch operator {
+			case "==":
+				return c == 0
+			case "!=":
+				return c != 0
+			case "<":
+				return c < 0
+			case "<=":
+				return c <= 0
+			case ">":
+				return c > 0
+			default:
+				return c >= 0
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Unrecognized operator '%s' in filter expression", operator)
+	}
+	return func(e tail.Entry) bool {
+		s, ok := subjectValue(e, subject)
+		return ok && match(s)
+	}, nil
+}
+
+// comparator returns a function comparing a value with the given one. It
+// returns a negative number, zero or a positive number when the value is
+// lower, equal or greater
+func comparator(subject string, value string) func(string) int {
+	if subject == "level" {
+		if level, err := tail.ParseLevel(value); err == nil {
+			return func(s string) int {
+				found, _ := tail.ParseLevel(s)
+				return int(found) - int(level)
+			}
+		}
+	}
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		return func(s string) int {
+			found, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return strings.Compare(s, value)
+			}
+			return compareFloats(found, n)
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return func(s string) int {
+			found, err := time.ParseDuration(s)
+			if err != nil {
+				return strings.Compare(s, value)
+			}
+			return compareFloats(float64(found), float64(d))
+		}
+	}
+	return func(s string) int {
+		return strings.Compare(s, value)
+	}
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package filter
+
+import (
+	"testing"
+
+	"github.com/oscar-martin/tail_folders/tail"
+)
+
+func TestCompile(t *testing.T) {
+	entry := tail.Entry{
+		Filename: "app.log",
+		Message:  "request served in time",
+		Level:    "warn",
+		Fields:   map[string]interface{}{"status": 503, "dur": "1.5s", "path": "/api/users"},
+		Labels:   map[string]string{"env": "prod", "status": "label"},
+	}
+	tests := []struct {
+		expression string
+		wanted     bool
+	}{
+		{`"served"`, true},
+		{`"SERVED"`, false},
+		{`msg icontains SERVED`, true},
+		{`not "served"`, false},
+		{`! "served" || "time"`, true},
+		{`"served" and "failed"`, false},
+		{`"served" AND ("failed" OR file == app.log)`, true},
+		{`status >= 500 && status < 600`, true},
+		{`status == 200`, false},
+		{`dur > 500ms`, true},
+		{`dur > 2s`, false},
+		{`level >= warn`, true},
+		{`level > warning`, false},
+		{`path matches "^/api/"`, true},
+		{`path imatches "^/API/"`, true},
+		{`user == ""`, false},
+		{`user != bob`, false},
+		{`message contains "in time"`, true},
+		{`env == prod and status == 503`, true},
+		{`region == eu`, false},
+	}
+	for _, test := range tests {
+		f, err := Compile(test.expression)
+		if err != nil {
+			t.Errorf("Unexpected error compiling %s: %v", test.expression, err)
+			continue
+		}
+		if found := f(entry); found != test.wanted {
+			t.Errorf("Found: %v; wanted: %v for %s", found, test.wanted, test.expression)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	expressions := []string{
+		``,
+		`"served" and`,
+		`("served"`,
+		`"served")`,
+		`msg like served`,
+		`msg contains`,
+		`path matches "("`,
+		`"unterminated`,
+	}
+	for _, expression := range expressions {
+		if _, err := Compile(expression); err == nil {
+			t.Errorf("Expression '%s' should be wrong", expression)
+		}
+	}
+}
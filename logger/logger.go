@@ -8,12 +8,16 @@ import (
 	"path"
 )
 
+// FolderName is the name of the folder where the log file is created. It is
+// hidden for avoiding being tracked itself
+const FolderName = ".logdir"
+
 var (
 	Info          = log.New(ioutil.Discard, "", log.Lshortfile)
 	ProcessLog    = log.New(ioutil.Discard, "", log.Lshortfile)
 	Warning       = log.New(ioutil.Discard, "", log.Lshortfile)
 	Error         = log.New(ioutil.Discard, "", log.Lshortfile)
-	logFolderName = "./.logdir"
+	logFolderName = "./" + FolderName
 )
 
 // InitLogs allows customization for loggers
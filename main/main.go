@@ -6,12 +6,15 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/oscar-martin/tail_folders/checkpoint"
 	"github.com/oscar-martin/tail_folders/command"
+	"github.com/oscar-martin/tail_folders/filter"
 	"github.com/oscar-martin/tail_folders/logger"
 	"github.com/oscar-martin/tail_folders/tail"
 	"github.com/oscar-martin/tail_folders/watcher"
@@ -22,12 +25,90 @@ const (
 	outputRaw  = "raw"
 )
 
+// redactHashKeyEnv is the environment variable holding the key of hashes of
+// sensitive data when redact_hash_key is not set, which keeps it out of the
+// command line
+const redactHashKeyEnv = "TAIL_FOLDERS_REDACT_HASH_KEY"
+
+// stringsFlag is a flag that can be repeated for setting several values. The
+// values it is created with are defaults, replaced by the ones set, if any
+type stringsFlag struct {
+	values []string
+	set    bool
+}
+
+func (s *stringsFlag) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(s.values, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	if !s.set {
+		s.values = nil
+		s.set = true
+	}
+	s.values = append(s.values, strings.TrimSpace(value))
+	return nil
+}
+
 var (
 	exitCode   = 0
 	appVersion string
 	rev        string
 )
 
+// config gathers the settings provided by command arguments
+type config struct {
+	folderPaths        string
+	recursive          bool
+	expressionType     string
+	filters            []string
+	excludes           []string
+	excludeFolders     []string
+	maxDepth           int
+	includeHidden      bool
+	followSymlinks     bool
+	confineSymlinks    bool
+	contentFilterType  string
+	contentFilter      string
+	contentFilterField string
+	tag                string
+	timeout            int
+	oldFiles           int
+	registryPath       string
+	registryInterval   int
+	initialStart       tail.StartPosition
+	createdStart       tail.StartPosition
+	multilinePattern   string
+	multilineMatch     string
+	multilineMaxLines  int
+	multilineTimeout   int
+	maxLineSize        int
+	splitLongLines     bool
+	parser             string
+	regexPattern       string
+	messageKey         string
+	timestampLayout    string
+	timestampField     string
+	timestampPattern   string
+	timestampTimezone  string
+	minLevel           tail.Level
+	redact             string
+	redactRules        []string
+	redactMode         tail.RedactMode
+	redactHashKey      string
+	labels             map[string]string
+	pathPattern        string
+	containerFormat    tail.ContainerFormat
+	rateLimit          float64
+	globalRateLimit    float64
+	rateLimitSample    int
+	rateLimitReport    int
+	collapseRepeated   int
+}
+
 func main() {
 	// p := profile.Start(profile.MemProfile, profile.ProfilePath("."), profile.NoShutdownHook)
 	// p := profile.Start(profile.CPUProfile, profile.ProfilePath("."), profile.NoShutdownHook)
@@ -37,16 +118,60 @@ func main() {
 	}()
 
 	// processing command arguments
-	folderPathsPtr := flag.String("folders", ".", "Paths of the folders to watch for log files, separated by comma (,). IT SHOULD NOT BE NESTED")
+	folderPathsPtr := flag.String("folders", ".", "Paths of the folders to watch for log files, separated by comma (,). They may be nested, in which case files are tailed once, as part of their most specific folder")
 	recursivePtr := flag.Bool("recursive", true, "Whether or not recursive folders should be watched")
 	expressionTypePtr := flag.String("filter_by", "glob", "Expression type: Either 'glob' or 'regex'")
-	filterPtr := flag.String("filter", "*.log", "Filter expression to apply on filenames")
-	contentFilterTypePtr := flag.String("content_filter_by", "no-filter", "Content filter type: Either 'include', 'exclude', 'regex' or 'no-filter'")
+	filters := stringsFlag{values: []string{"*.log"}}
+	flag.Var(&filters, "filter", "Filter expression to apply on the path of files relative to the watched folder, or on their filename when it has no slash (/). Files matching any of them are tailed. It can be repeated")
+	var excludes stringsFlag
+	flag.Var(&excludes, "exclude", "Filter expression to apply on the path of files relative to the watched folder, or on their filename when it has no slash (/). Files matching any of them are not tailed. It can be repeated")
+	var excludeFolders stringsFlag
+	flag.Var(&excludeFolders, "exclude_folder", "Filter expression to apply on the path of subfolders relative to the watched folder, or on their name when it has no slash (/). Subfolders matching any of them are neither scanned nor watched. It can be repeated")
+	maxDepthPtr := flag.Int("max_depth", 0, "Maximum amount of nested levels of subfolders watched when recursive. No limit when it is not positive")
+	includeHiddenPtr := flag.Bool("include_hidden", false, "Whether or not hidden folders, whose name starts with a dot (.), are scanned and watched. Hidden files are always considered, while the folder where tail_folders writes its own log is always skipped")
+	followSymlinksPtr := flag.Bool("follow_symlinks", false, "Whether or not symbolic links to folders are watched. Files and folders reached through several paths, e.g. because of loops, are considered once. Symbolic links to files are always tailed")
+	confineSymlinksPtr := flag.Bool("confine_symlinks", false, "Whether or not symbolic links to targets out of the watched folder are skipped when following them")
+	contentFilterTypePtr := flag.String("content_filter_by", "no-filter", "Content filter type: Either 'include', 'exclude', 'regex', 'expression' or 'no-filter'")
 	contentFilterPtr := flag.String("content_filter", "", "Filter expression to apply on tailed lines")
+	contentFilterFieldPtr := flag.String("content_filter_field", "", "Parsed field to apply the content filter on instead of the whole message")
 	tagPtr := flag.String("tag", "", "Optional tag to use for each line")
 	outputPtr := flag.String("output", "json", "Output type: Either 'raw' or 'json'")
+	rawTemplatePtr := flag.String("raw_template", "", "Go template for formatting entries in raw output, e.g. '{{.Labels.env}} [{{.File}}] {{.Message}}'. The default format is used when empty")
+	labelsPtr := flag.String("labels", "", "Labels attached to every entry as key=value pairs separated by comma (,). Values can reference environment variables as ${NAME}")
+	labelsEnvPrefixPtr := flag.String("labels_env_prefix", "", "Prefix of the environment variables attached as labels to every entry, named after the rest of the variable name in lower case. Disabled when empty")
+	jsonFieldsPtr := flag.String("json_fields", "nested", "How parsed fields are set in json output: Either 'nested' under 'fields' or 'merged' at top level")
+	containerFormatPtr := flag.String("container_format", "none", "Container runtime format tailed lines are unwrapped from: Either 'docker' for docker json-file logs, 'cri' for containerd or cri-o logs, 'auto' or 'none'")
+	parserPtr := flag.String("parser", "none", "Parser for extracting fields out of tailed lines: Either 'json', 'logfmt', 'regex', 'syslog' or 'none'")
+	regexPatternPtr := flag.String("regex_pattern", "", "Regex with named groups used by the regex parser. Built-in patterns can be referenced as %{NAME} or %{NAME:field}")
+	pathPatternPtr := flag.String("path_pattern", "", "Regex matched against the absolute path of tailed files whose named groups become fields of their lines, e.g. '/logs/(?P<service>[^/]+)/', or 'kubernetes' for the metadata of pods in kubelet log paths")
+	messageKeyPtr := flag.String("message_key", "msg", "Parsed field used as message")
 	timeoutPtr := flag.Int("timeout", -1, "Time to wait till stop tailing when no activity is detected in a folder (seconds)")
 	oldFilesPtr := flag.Int("discard-files-older-than", -1, "Discard tailing files not recently modified (seconds)")
+	initialPositionPtr := flag.String("initial_position", "end", "Where to start tailing files found at startup: Either 'beginning', 'end' or 'last:N' for the last N lines")
+	createdPositionPtr := flag.String("created_position", "beginning", "Where to start tailing files created after startup: Either 'beginning', 'end' or 'last:N' for the last N lines")
+	multilinePatternPtr := flag.String("multiline_pattern", "", "Regex for joining related lines, e.g. stack traces, into a single message. Disabled when empty")
+	multilineMatchPtr := flag.String("multiline_match", "start", "What multiline_pattern matches: Either 'start' for the first line of a message or 'continuation' for the rest of lines")
+	multilineMaxLinesPtr := flag.Int("multiline_max_lines", 500, "Maximum number of lines joined into a single message. No limit when it is not positive")
+	multilineTimeoutPtr := flag.Int("multiline_timeout", 1000, "Time to wait for more lines before sending a joined message (milliseconds)")
+	maxLineSizePtr := flag.Int("max_line_size", 1024*1024, "Maximum size of a line (bytes). No limit when it is not positive")
+	longLinesPtr := flag.String("long_lines", "truncate", "What to do with lines longer than max_line_size: Either 'truncate' or 'split'")
+	timestampLayoutPtr := flag.String("timestamp_layout", "", "Go layout of the timestamp found in tailed lines, a predefined one such as 'RFC3339', 'unix' or 'unix_ms'. The read time is used when empty")
+	timestampFieldPtr := flag.String("timestamp_field", "", "Parsed field holding the timestamp")
+	timestampPatternPtr := flag.String("timestamp_pattern", "", "Regex for finding the timestamp in tailed lines when there is no timestamp_field. Its first group is used if any. The timestamp is expected at the start of lines when both are empty")
+	timestampTimezonePtr := flag.String("timestamp_timezone", "Local", "Timezone of timestamps without one, e.g. 'UTC' or 'Europe/Madrid'")
+	minLevelPtr := flag.String("min_level", "", "Minimum level of tailed lines: Either 'trace', 'debug', 'info', 'warn', 'error' or 'fatal'. Lines with unknown level are kept. No minimum when empty")
+	rateLimitPtr := flag.Float64("rate_limit", 0, "Maximum amount of lines per second sent for every file, allowing bursts of a second worth of lines. No limit when it is not positive")
+	globalRateLimitPtr := flag.Float64("global_rate_limit", 0, "Maximum amount of lines per second sent for all files, allowing bursts of a second worth of lines. No limit when it is not positive")
+	rateLimitModePtr := flag.String("rate_limit_mode", "drop", "What to do with lines exceeding rate limits: Either 'drop' or 'sample:N' for sending one in every N of them, where N is greater than 1")
+	rateLimitReportPtr := flag.Int("rate_limit_report", 10, "Time between the lines reporting how many lines of a file have been suppressed by rate limits (seconds). No reports when it is not positive")
+	collapseRepeatedPtr := flag.Int("collapse_repeated", 0, "Collapse consecutive repeated lines of a file into a 'last message repeated N times' line, sent when a different line arrives or after this time (seconds). Disabled when it is not positive")
+	registryPtr := flag.String("registry", "", "Path of the file where read offsets are persisted for resuming after a restart. Disabled when empty")
+	registryIntervalPtr := flag.Int("registry_interval", 5, "Time between persisting read offsets into the registry file (seconds). They are only persisted on exit when it is not positive")
+	redactPtr := flag.String("redact", "", "Built-in detectors of sensitive data to redact, separated by comma (,): 'email', 'card', 'token', 'aws_key', 'secret' or 'all'. Disabled when empty")
+	var redactRules stringsFlag
+	flag.Var(&redactRules, "redact_rule", "Regex finding sensitive data to redact. Only its first group is redacted if it has any. It can be repeated")
+	redactModePtr := flag.String("redact_mode", "mask", "What to do with sensitive data: Either 'mask', 'hash' or 'drop' for discarding the whole line")
+	redactHashKeyPtr := flag.String("redact_hash_key", "", "Secret key of the hashes of sensitive data in redact_mode 'hash'. The "+redactHashKeyEnv+" environment variable is used when empty")
 	versionPtr := flag.Bool("version", false, "Print the version")
 
 	flag.Usage = func() {
@@ -68,76 +193,267 @@ func main() {
 		os.Exit(0)
 	}
 
-	folderPathsStr := strings.TrimSpace(*folderPathsPtr)
-	expressionTypeStr := strings.TrimSpace(*expressionTypePtr)
-	filterStr := strings.TrimSpace(*filterPtr)
-	contentFilterTypeStr := strings.TrimSpace(*contentFilterTypePtr)
-	contentFilterStr := strings.TrimSpace(*contentFilterPtr)
-	tagStr := strings.TrimSpace(*tagPtr)
+	cfg := config{
+		folderPaths:        strings.TrimSpace(*folderPathsPtr),
+		recursive:          *recursivePtr,
+		expressionType:     strings.TrimSpace(*expressionTypePtr),
+		filters:            filters.values,
+		excludes:           excludes.values,
+		excludeFolders:     excludeFolders.values,
+		maxDepth:           *maxDepthPtr,
+		includeHidden:      *includeHiddenPtr,
+		followSymlinks:     *followSymlinksPtr,
+		confineSymlinks:    *confineSymlinksPtr,
+		contentFilterType:  strings.TrimSpace(*contentFilterTypePtr),
+		contentFilter:      strings.TrimSpace(*contentFilterPtr),
+		contentFilterField: strings.TrimSpace(*contentFilterFieldPtr),
+		tag:                strings.TrimSpace(*tagPtr),
+		timeout:            *timeoutPtr,
+		oldFiles:           *oldFilesPtr,
+		registryPath:       strings.TrimSpace(*registryPtr),
+		registryInterval:   *registryIntervalPtr,
+		multilinePattern:   strings.TrimSpace(*multilinePatternPtr),
+		multilineMatch:     strings.TrimSpace(*multilineMatchPtr),
+		multilineMaxLines:  *multilineMaxLinesPtr,
+		multilineTimeout:   *multilineTimeoutPtr,
+		maxLineSize:        *maxLineSizePtr,
+		parser:             strings.TrimSpace(*parserPtr),
+		regexPattern:       strings.TrimSpace(*regexPatternPtr),
+		messageKey:         strings.TrimSpace(*messageKeyPtr),
+		pathPattern:        strings.TrimSpace(*pathPatternPtr),
+		timestampLayout:    strings.TrimSpace(*timestampLayoutPtr),
+		timestampField:     strings.TrimSpace(*timestampFieldPtr),
+		timestampPattern:   strings.TrimSpace(*timestampPatternPtr),
+		timestampTimezone:  strings.TrimSpace(*timestampTimezonePtr),
+		redact:             strings.TrimSpace(*redactPtr),
+		redactRules:        redactRules.values,
+		redactHashKey:      *redactHashKeyPtr,
+		rateLimit:          *rateLimitPtr,
+		globalRateLimit:    *globalRateLimitPtr,
+		rateLimitReport:    *rateLimitReportPtr,
+		collapseRepeated:   *collapseRepeatedPtr,
+	}
 	outputStr := strings.TrimSpace(*outputPtr)
-	timeout := *timeoutPtr
-	oldFiles := *oldFilesPtr
+	jsonFieldsStr := strings.TrimSpace(*jsonFieldsPtr)
+	rawTemplateStr := strings.TrimSpace(*rawTemplatePtr)
+
+	var err error
+	if cfg.initialStart, err = tail.ParseStartPosition(strings.TrimSpace(*initialPositionPtr)); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.createdStart, err = tail.ParseStartPosition(strings.TrimSpace(*createdPositionPtr)); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.splitLongLines, err = parseLongLines(strings.TrimSpace(*longLinesPtr)); err != nil {
+		log.Fatal(err)
+	}
+	if minLevelStr := strings.TrimSpace(*minLevelPtr); minLevelStr != "" {
+		if cfg.minLevel, err = tail.ParseLevel(minLevelStr); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if cfg.labels, err = createLabels(strings.TrimSpace(*labelsPtr), strings.TrimSpace(*labelsEnvPrefixPtr), os.Environ()); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.containerFormat, err = tail.ParseContainerFormat(strings.TrimSpace(*containerFormatPtr)); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.rateLimitSample, err = parseRateLimitMode(strings.TrimSpace(*rateLimitModePtr)); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.redactMode, err = tail.ParseRedactMode(strings.TrimSpace(*redactModePtr)); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.redactHashKey == "" {
+		cfg.redactHashKey = os.Getenv(redactHashKeyEnv)
+	}
 
 	// initialize loggers
 	logFile := logger.CreateLogFile()
 	logger.InitLogs(logFile, logFile, logFile, logFile)
 
 	logger.Info.Println("Arguments in place:")
-	logger.Info.Printf("- folders: %s", folderPathsStr)
-	logger.Info.Printf("- recursive: %v", *recursivePtr)
-	logger.Info.Printf("- filter_by: %s", expressionTypeStr)
-	logger.Info.Printf("- filter: %s", filterStr)
-	logger.Info.Printf("- content_filter_by: %s", contentFilterTypeStr)
-	logger.Info.Printf("- content_filter: %s", contentFilterStr)
-	logger.Info.Printf("- tag: %s", tagStr)
+	logger.Info.Printf("- folders: %s", cfg.folderPaths)
+	logger.Info.Printf("- recursive: %v", cfg.recursive)
+	logger.Info.Printf("- filter_by: %s", cfg.expressionType)
+	logger.Info.Printf("- filter: %v", cfg.filters)
+	logger.Info.Printf("- exclude: %v", cfg.excludes)
+	logger.Info.Printf("- exclude_folder: %v", cfg.excludeFolders)
+	logger.Info.Printf("- max_depth: %d", cfg.maxDepth)
+	logger.Info.Printf("- include_hidden: %v", cfg.includeHidden)
+	logger.Info.Printf("- follow_symlinks: %v", cfg.followSymlinks)
+	logger.Info.Printf("- confine_symlinks: %v", cfg.confineSymlinks)
+	logger.Info.Printf("- content_filter_by: %s", cfg.contentFilterType)
+	logger.Info.Printf("- content_filter: %s", cfg.contentFilter)
+	logger.Info.Printf("- content_filter_field: %s", cfg.contentFilterField)
+	logger.Info.Printf("- tag: %s", cfg.tag)
 	logger.Info.Printf("- output: %s", outputStr)
-	logger.Info.Printf("- timeout: %d", timeout)
-	logger.Info.Printf("- discard-files-older-than: %d", oldFiles)
+	logger.Info.Printf("- json_fields: %s", jsonFieldsStr)
+	logger.Info.Printf("- raw_template: %s", rawTemplateStr)
+	logger.Info.Printf("- labels: %v", cfg.labels)
+	logger.Info.Printf("- container_format: %s", strings.TrimSpace(*containerFormatPtr))
+	logger.Info.Printf("- parser: %s", cfg.parser)
+	logger.Info.Printf("- regex_pattern: %s", cfg.regexPattern)
+	logger.Info.Printf("- message_key: %s", cfg.messageKey)
+	logger.Info.Printf("- path_pattern: %s", cfg.pathPattern)
+	logger.Info.Printf("- timestamp_layout: %s", cfg.timestampLayout)
+	logger.Info.Printf("- timestamp_field: %s", cfg.timestampField)
+	logger.Info.Printf("- timestamp_pattern: %s", cfg.timestampPattern)
+	logger.Info.Printf("- timestamp_timezone: %s", cfg.timestampTimezone)
+	logger.Info.Printf("- min_level: %v", cfg.minLevel)
+	logger.Info.Printf("- redact: %s", cfg.redact)
+	logger.Info.Printf("- redact_rule: %v", cfg.redactRules)
+	logger.Info.Printf("- redact_mode: %s", strings.TrimSpace(*redactModePtr))
+	// the key itself is kept out of the log
+	logger.Info.Printf("- redact_hash_key set: %v", cfg.redactHashKey != "")
+	logger.Info.Printf("- rate_limit: %v", cfg.rateLimit)
+	logger.Info.Printf("- global_rate_limit: %v", cfg.globalRateLimit)
+	logger.Info.Printf("- rate_limit_mode: %s", strings.TrimSpace(*rateLimitModePtr))
+	logger.Info.Printf("- rate_limit_report: %d", cfg.rateLimitReport)
+	logger.Info.Printf("- collapse_repeated: %d", cfg.collapseRepeated)
+	logger.Info.Printf("- timeout: %d", cfg.timeout)
+	logger.Info.Printf("- discard-files-older-than: %d", cfg.oldFiles)
+	logger.Info.Printf("- initial_position: %v", cfg.initialStart)
+	logger.Info.Printf("- created_position: %v", cfg.createdStart)
+	logger.Info.Printf("- multiline_pattern: %s", cfg.multilinePattern)
+	logger.Info.Printf("- multiline_match: %s", cfg.multilineMatch)
+	logger.Info.Printf("- multiline_max_lines: %d", cfg.multilineMaxLines)
+	logger.Info.Printf("- multiline_timeout: %d", cfg.multilineTimeout)
+	logger.Info.Printf("- max_line_size: %d", cfg.maxLineSize)
+	logger.Info.Printf("- long_lines split: %v", cfg.splitLongLines)
+	logger.Info.Printf("- registry: %s", cfg.registryPath)
+	logger.Info.Printf("- registry_interval: %d", cfg.registryInterval)
 	if flag.NArg() > 0 {
 		logger.Info.Printf("- command: %v", flag.Args())
 	}
 
 	// create output func
-	outputFunc, err := createEntryToStringFunc(outputStr)
+	outputFunc, err := createEntryToStringFunc(outputStr, jsonFieldsStr, rawTemplateStr)
 	if err != nil {
 		log.Fatal(err)
 	}
 	// run program
 	outWriter := tail.MakeStdOutWriter(outputFunc)
-	run(folderPathsStr, expressionTypeStr, filterStr, contentFilterTypeStr, contentFilterStr, tagStr, *recursivePtr, flag.Args(), outWriter, timeout, oldFiles)
+	run(cfg, flag.Args(), outWriter)
 	// p.Stop()
 }
 
-func run(
-	folderPathsStr,
-	expressionTypeStr,
-	filterStr,
-	contentFilterTypeStr,
-	contentFilterStr,
-	tagStr string,
-	recursive bool,
-	commandAndArguments []string,
-	ow *tail.OutWriter,
-	timeout,
-	oldFiles int) {
+func run(cfg config, commandAndArguments []string, ow *tail.OutWriter) {
 	// create filename filter
-	filterFunc, err := createFilterFunc(expressionTypeStr, filterStr)
+	filterFunc, err := createFilterFunc(cfg.expressionType, cfg.filters, cfg.excludes)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	// create subfolders settings
+	excludeFolders, err := watcher.NewPathPatterns(cfg.expressionType, cfg.excludeFolders)
+	if err != nil {
+		log.Fatal(err)
+	}
+	folderOptions := watcher.FolderOptions{
+		Recursive:      cfg.recursive,
+		MaxDepth:       cfg.maxDepth,
+		ExcludeFolders: excludeFolders,
+		IncludeHidden:  cfg.includeHidden,
+		FollowSymlinks: cfg.followSymlinks,
+		ConfineToRoot:  cfg.confineSymlinks,
+	}
+
 	// create content filter
-	contentFilterFunc, err := createContentFilterFunc(contentFilterTypeStr, contentFilterStr)
+	contentFilterFunc, err := createContentFilterFunc(cfg.contentFilterType, cfg.contentFilter)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// create content filter expression
+	entryFilter, err := createEntryFilter(cfg.contentFilterType, cfg.contentFilter)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// create parser
+	parser, err := createParser(cfg.parser, cfg.regexPattern, cfg.messageKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// create timestamp extraction settings
+	timestamp, err := createTimestamp(cfg.timestampLayout, cfg.timestampField, cfg.timestampPattern, cfg.timestampTimezone)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// create multiline settings
+	multiline, err := createMultiline(cfg.multilinePattern, cfg.multilineMatch, cfg.multilineMaxLines, cfg.multilineTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// create redaction settings
+	redactor, err := createRedactor(cfg.redact, cfg.redactRules, cfg.redactMode, cfg.redactHashKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// create path fields settings
+	pathPattern, err := createPathPattern(cfg.pathPattern)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	tailConfig := tail.Config{
+		Accept:                   contentFilterFunc,
+		InitialStart:             cfg.initialStart,
+		CreatedStart:             cfg.createdStart,
+		Multiline:                multiline,
+		MaxLineSize:              cfg.maxLineSize,
+		SplitLongLines:           cfg.splitLongLines,
+		Parser:                   parser,
+		FilterField:              cfg.contentFilterField,
+		Timestamp:                timestamp,
+		MinLevel:                 cfg.minLevel,
+		EntryFilter:              entryFilter,
+		Redactor:                 redactor,
+		Labels:                   cfg.labels,
+		PathPattern:              pathPattern,
+		ContainerFormat:          cfg.containerFormat,
+		SuppressedReportInterval: time.Duration(cfg.rateLimitReport) * time.Second,
+		CollapseTimeout:          time.Duration(cfg.collapseRepeated) * time.Second,
+	}
+
+	// create rate limits
+	if cfg.rateLimit > 0 {
+		tailConfig.RateLimit = &tail.RateLimit{Rate: cfg.rateLimit, Sample: cfg.rateLimitSample}
+	}
+	if cfg.globalRateLimit > 0 {
+		tailConfig.GlobalRateLimiter = tail.NewRateLimiter(tail.RateLimit{Rate: cfg.globalRateLimit, Sample: cfg.rateLimitSample})
+	}
+
+	// load checkpoints for resuming files where they were left
+	if cfg.registryPath != "" {
+		registry, err := checkpoint.Load(cfg.registryPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		registry.Start(time.Duration(cfg.registryInterval) * time.Second)
+		defer func() {
+			if err := registry.Close(); err != nil {
+				logger.Error.Printf("Unable to save checkpoints into '%s': %v\n", cfg.registryPath, err)
+			}
+		}()
+		tailConfig.Registry = registry
+	}
+
 	// init program
 	stdoutChan := make(chan tail.Entry)
-	go ow.Start(stdoutChan, tagStr)
+	go ow.Start(stdoutChan, cfg.tag)
 
-	for _, folderPath := range strings.Split(folderPathsStr, ",") {
-		rootFolderWatcher := watcher.MakeRootFolderWatcher(folderPath, stdoutChan, recursive, filterFunc, contentFilterFunc, timeout, oldFiles)
+	// roots share a registry so files under nested or overlapping ones are tailed once
+	folderPaths := strings.Split(cfg.folderPaths, ",")
+	folderOptions.Registry = watcher.NewRootRegistry(folderPaths)
+	for _, folderPath := range folderPaths {
+		rootFolderWatcher := watcher.MakeRootFolderWatcher(folderPath, stdoutChan, folderOptions, filterFunc, tailConfig, cfg.timeout, cfg.oldFiles)
 		defer rootFolderWatcher.Close()
 		err := rootFolderWatcher.Watch()
 		if err != nil {
@@ -161,30 +477,62 @@ func run(
 	}
 }
 
-func createEntryToStringFunc(outputStr string) (func(tail.Entry, string) (string, error), error) {
+func createEntryToStringFunc(outputStr string, jsonFieldsStr string, rawTemplateStr string) (func(tail.Entry, string) (string, error), error) {
 	var outputFunc func(tail.Entry, string) (string, error)
 	switch outputStr {
 	case outputRaw:
-		outputFunc = tail.EntryToRawString
+		if rawTemplateStr == "" {
+			outputFunc = tail.EntryToRawString
+			break
+		}
+		templateFunc, err := tail.EntryToTemplateString(rawTemplateStr)
+		if err != nil {
+			return nil, fmt.Errorf("Wrong raw_template value: %v", err)
+		}
+		outputFunc = templateFunc
 	case outputJson:
-		outputFunc = tail.EntryToJsonString
+		switch jsonFieldsStr {
+		case "nested":
+			outputFunc = tail.EntryToJsonString
+		case "merged":
+			outputFunc = tail.EntryToMergedJsonString
+		default:
+			return nil, fmt.Errorf("Unrecognized json_fields value: %s", jsonFieldsStr)
+		}
 	default:
 		return nil, fmt.Errorf("Unrecognized output value: %s", outputStr)
 	}
 	return outputFunc, nil
 }
 
-func createFilterFunc(expressionTypeStr string, filterStr string) (func(string) bool, error) {
-	var filterFunc func(string) bool
-	switch expressionTypeStr {
-	case "glob":
-		filterFunc = filterByGlob(filterStr)
+// createParser returns a nil parser when no parsing is required
+func createParser(parserStr string, regexPattern string, messageKey string) (tail.Parser, error) {
+	switch parserStr {
+	case "none", "":
+		return nil, nil
+	case "json":
+		return tail.JSONParser(messageKey), nil
+	case "logfmt":
+		return tail.LogfmtParser(messageKey), nil
+	case "syslog":
+		return tail.SyslogParser(), nil
 	case "regex":
-		filterFunc = filterByRegex(filterStr)
+		parser, err := tail.RegexParser(regexPattern, messageKey)
+		if err != nil {
+			return nil, fmt.Errorf("Regex pattern '%s' is not right: %v", regexPattern, err)
+		}
+		return parser, nil
 	default:
-		return nil, fmt.Errorf("Unrecognized filter_by value: %s", expressionTypeStr)
+		return nil, fmt.Errorf("Unrecognized parser value: %s", parserStr)
 	}
-	return filterFunc, nil
+}
+
+func createFilterFunc(expressionTypeStr string, filters []string, excludes []string) (func(string) bool, error) {
+	pathFilter, err := watcher.NewPathFilter(expressionTypeStr, filters, excludes)
+	if err != nil {
+		return nil, err
+	}
+	return pathFilter.Match, nil
 }
 
 func createContentFilterFunc(filterTypeStr string, filterStr string) (func(string) bool, error) {
@@ -196,7 +544,8 @@ func createContentFilterFunc(filterTypeStr string, filterStr string) (func(strin
 		filterFunc = contentFilterContain(filterStr)
 	case "regex":
 		filterFunc = contentFilterByRegex(filterStr)
-	case "no-filter":
+	case "no-filter", "expression":
+		// expressions are applied on whole entries by createEntryFilter
 		filterFunc = func(string) bool { return true }
 	default:
 		return nil, fmt.Errorf("Unrecognized content_filter_by value: %s", filterTypeStr)
@@ -204,22 +553,166 @@ func createContentFilterFunc(filterTypeStr string, filterStr string) (func(strin
 	return filterFunc, nil
 }
 
-func filterByGlob(globPattern string) func(string) bool {
-	_, err := filepath.Match(globPattern, "text.txt")
+// createEntryFilter compiles the content filter when it is an expression. It
+// returns nil otherwise
+func createEntryFilter(filterTypeStr string, filterStr string) (func(tail.Entry) bool, error) {
+	if filterTypeStr != "expression" {
+		return nil, nil
+	}
+	entryFilter, err := filter.Compile(filterStr)
 	if err != nil {
-		log.Fatalf("Globbing Expression '%s' is not right: %v", globPattern, err)
+		return nil, fmt.Errorf("Wrong content_filter expression: %v", err)
 	}
+	return entryFilter, nil
+}
 
-	return func(filename string) bool {
-		matched, _ := filepath.Match(globPattern, filename)
-		return matched
+func createMultiline(pattern string, match string, maxLines int, timeout int) (*tail.Multiline, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Multiline pattern '%s' is not right: %v", pattern, err)
+	}
+	multiline := &tail.Multiline{
+		Pattern:      regex,
+		MaxLines:     maxLines,
+		FlushTimeout: time.Duration(timeout) * time.Millisecond,
 	}
+	switch match {
+	case "start":
+	case "continuation":
+		multiline.Continuation = true
+	default:
+		return nil, fmt.Errorf("Unrecognized multiline_match value: %s", match)
+	}
+	return multiline, nil
 }
 
-func filterByRegex(regexStr string) func(string) bool {
-	regex := regexp.MustCompile(regexStr)
-	return func(filename string) bool {
-		return regex.MatchString(filename)
+// createTimestamp returns nil settings when the read time must be used
+func createTimestamp(layout string, field string, pattern string, timezone string) (*tail.Timestamp, error) {
+	if layout == "" {
+		return nil, nil
+	}
+	var regex *regexp.Regexp
+	if pattern != "" {
+		var err error
+		if regex, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("Timestamp pattern '%s' is not right: %v", pattern, err)
+		}
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("Unrecognized timestamp_timezone value: %s", timezone)
+	}
+	return tail.NewTimestamp(field, regex, layout, location), nil
+}
+
+// createPathPattern returns a nil pattern when no fields are taken out of paths
+func createPathPattern(pathPatternStr string) (*regexp.Regexp, error) {
+	switch pathPatternStr {
+	case "":
+		return nil, nil
+	case "kubernetes":
+		return tail.KubernetesPathPattern, nil
+	}
+	pathPattern, err := regexp.Compile(pathPatternStr)
+	if err != nil {
+		return nil, fmt.Errorf("Regex '%s' in path_pattern is not right: %v", pathPatternStr, err)
+	}
+	return pathPattern, nil
+}
+
+// createLabels returns the labels set as key=value pairs in labelsStr along
+// with the ones taken from the environment variables starting with envPrefix.
+// The former take precedence. It returns nil when there are none
+func createLabels(labelsStr string, envPrefix string, environ []string) (map[string]string, error) {
+	labels := map[string]string{}
+	if envPrefix != "" {
+		for _, variable := range environ {
+			pair := strings.SplitN(variable, "=", 2)
+			if len(pair) == 2 && strings.HasPrefix(pair[0], envPrefix) && len(pair[0]) > len(envPrefix) {
+				labels[strings.ToLower(strings.TrimPrefix(pair[0], envPrefix))] = pair[1]
+			}
+		}
+	}
+	if labelsStr != "" {
+		for _, label := range strings.Split(labelsStr, ",") {
+			pair := strings.SplitN(label, "=", 2)
+			key := strings.TrimSpace(pair[0])
+			if len(pair) != 2 || key == "" {
+				return nil, fmt.Errorf("Wrong label '%s'. It should be key=value", label)
+			}
+			labels[key] = os.ExpandEnv(strings.TrimSpace(pair[1]))
+		}
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, nil
+}
+
+// createRedactor returns the redaction settings out of the built-in detectors
+// and the user-defined rules, or nil when there are none
+func createRedactor(detectorsStr string, rules []string, mode tail.RedactMode, hashKey string) (*tail.Redactor, error) {
+	redactRules := []tail.RedactRule{}
+	if detectorsStr != "" {
+		names := strings.Split(detectorsStr, ",")
+		if detectorsStr == "all" {
+			names = tail.RedactDetectorNames()
+		}
+		for _, name := range names {
+			rule, err := tail.RedactDetector(strings.TrimSpace(name))
+			if err != nil {
+				return nil, err
+			}
+			redactRules = append(redactRules, rule)
+		}
+	}
+	for i, rule := range rules {
+		pattern, err := regexp.Compile(rule)
+		if err != nil {
+			return nil, fmt.Errorf("Regex '%s' in redact_rule is not right: %v", rule, err)
+		}
+		redactRules = append(redactRules, tail.RedactRule{Name: fmt.Sprintf("rule%d", i+1), Pattern: pattern})
+	}
+	if len(redactRules) == 0 {
+		return nil, nil
+	}
+	redactor, err := tail.NewRedactor(redactRules, mode, []byte(hashKey))
+	if err != nil {
+		return nil, fmt.Errorf("%v: set redact_hash_key or %s", err, redactHashKeyEnv)
+	}
+	return redactor, nil
+}
+
+// parseRateLimitMode returns one in how many lines exceeding rate limits are
+// sent anyway. Zero means none
+func parseRateLimitMode(rateLimitModeStr string) (int, error) {
+	if rateLimitModeStr == "drop" {
+		return 0, nil
+	}
+	if strings.HasPrefix(rateLimitModeStr, "sample:") {
+		sample, err := strconv.Atoi(strings.TrimPrefix(rateLimitModeStr, "sample:"))
+		if err == nil && sample > 1 {
+			return sample, nil
+		}
+		if err == nil {
+			// sending one in every line would be no limit at all
+			return 0, fmt.Errorf("Sample of rate_limit_mode must be greater than 1: %s", rateLimitModeStr)
+		}
+	}
+	return 0, fmt.Errorf("Unrecognized rate_limit_mode value: %s", rateLimitModeStr)
+}
+
+func parseLongLines(longLinesStr string) (bool, error) {
+	switch longLinesStr {
+	case "truncate":
+		return false, nil
+	case "split":
+		return true, nil
+	default:
+		return false, fmt.Errorf("Unrecognized long_lines value: %s", longLinesStr)
 	}
 }
 
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"os"
+	"reflect"
 	"syscall"
 	"testing"
 	"time"
@@ -79,7 +80,7 @@ func TestTailOnSingleFile(t *testing.T) {
 
 	outWriter := tail.MakeOutStringWriter()
 	exit := runMain(func() {
-		run(".", "glob", "file*.log", "no-filter", "", "", false, make([]string, 0), outWriter, -1, -1)
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file*.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
 	})
 
 	writeInFile(tmpfile, "temporary file's content\n")
@@ -103,7 +104,7 @@ func TestTailOnSingleFileWithTag(t *testing.T) {
 
 	outWriter := tail.MakeOutStringWriter()
 	exit := runMain(func() {
-		run(".", "glob", "file*.log", "no-filter", "", "aTag", false, make([]string, 0), outWriter, -1, -1)
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file*.log"}, contentFilterType: "no-filter", tag: "aTag", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
 	})
 
 	writeInFile(tmpfile, "temporary file's content\n")
@@ -132,7 +133,7 @@ func TestTailOnSingleFileWithGlobFilterExecution(t *testing.T) {
 
 	outWriter := tail.MakeOutStringWriter()
 	exit := runMain(func() {
-		run(".", "glob", "file*.log", "no-filter", "", "", false, make([]string, 0), outWriter, -1, -1)
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file*.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
 	})
 
 	writeInFile(tmpfile, "temporary file's content\n")
@@ -164,7 +165,7 @@ func TestTailOnNonRecursiveSingleFileWithGlobFilterExecution(t *testing.T) {
 
 	outWriter := tail.MakeOutStringWriter()
 	exit := runMain(func() {
-		run(".", "glob", "file*.log", "no-filter", "", "", false, make([]string, 0), outWriter, -1, -1)
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file*.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
 	})
 
 	writeInFile(tmpfile, "temporary file's content\n")
@@ -196,7 +197,7 @@ func TestTailOnRecursiveSingleFileWithGlobFilterExecution(t *testing.T) {
 
 	outWriter := tail.MakeOutStringWriter()
 	exit := runMain(func() {
-		run(".", "glob", "file*.log", "no-filter", "", "", true, make([]string, 0), outWriter, -1, -1)
+		run(config{folderPaths: ".", recursive: true, expressionType: "glob", filters: []string{"file*.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
 	})
 
 	writeInFile(tmpfile, "temporary file's content\n")
@@ -229,7 +230,7 @@ func TestTailOnSingleFileWithRegexFilterExecution(t *testing.T) {
 
 	outWriter := tail.MakeOutStringWriter()
 	exit := runMain(func() {
-		run(".", "regex", "file.\\.[gol]{3}", "no-filter", "", "", false, make([]string, 0), outWriter, -1, -1)
+		run(config{folderPaths: ".", expressionType: "regex", filters: []string{"file.\\.[gol]{3}"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
 	})
 
 	writeInFile(tmpfile, "temporary file's content\n")
@@ -259,7 +260,7 @@ func TestTailOnTwoFiles(t *testing.T) {
 
 	outWriter := tail.MakeOutStringWriter()
 	exit := runMain(func() {
-		run(".", "glob", "file7.*", "no-filter", "", "", false, make([]string, 0), outWriter, -1, -1)
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file7.*"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
 	})
 
 	writeInFile(tmpfile, "temporary file's content\n")
@@ -287,7 +288,7 @@ func TestTailOnSingleFileWithIncludeContentFilter(t *testing.T) {
 
 	outWriter := tail.MakeOutStringWriter()
 	exit := runMain(func() {
-		run(".", "glob", "file*.log", "include", "INFO", "", false, make([]string, 0), outWriter, -1, -1)
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file*.log"}, contentFilterType: "include", contentFilter: "INFO", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
 	})
 
 	writeInFile(tmpfile, "[WARN] temporary file's content\n")
@@ -314,7 +315,7 @@ func TestTailOnSingleFileWithExcludeContentFilter(t *testing.T) {
 
 	outWriter := tail.MakeOutStringWriter()
 	exit := runMain(func() {
-		run(".", "glob", "file*.log", "exclude", "INFO", "", false, make([]string, 0), outWriter, -1, -1)
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file*.log"}, contentFilterType: "exclude", contentFilter: "INFO", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
 	})
 
 	writeInFile(tmpfile, "[WARN] temporary file's content\n")
@@ -341,7 +342,7 @@ func TestTailOnSingleFileWithRegexContentFilter(t *testing.T) {
 
 	outWriter := tail.MakeOutStringWriter()
 	exit := runMain(func() {
-		run(".", "glob", "file*.log", "regex", "^\\[.+\\]", "", false, make([]string, 0), outWriter, -1, -1)
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file*.log"}, contentFilterType: "regex", contentFilter: "^\\[.+\\]", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
 	})
 
 	writeInFile(tmpfile, "[WARN] temporary file's content\n")
@@ -359,3 +360,485 @@ func TestTailOnSingleFileWithRegexContentFilter(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// Create a log file after starting and write into it straight away. The output should see
+// what is written from the beginning of the file
+func TestTailOnCreatedFileFromBeginning(t *testing.T) {
+	sendInterruptToMyselfAfter(300 * time.Millisecond)
+
+	createdStart, _ := tail.ParseStartPosition("beginning")
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file8.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1, createdStart: createdStart}, make([]string, 0), outWriter)
+	})
+
+	tmpfile, closeFunc := createFile("./file8.log")
+	writeInFile(tmpfile, "first line\n")
+	writeInFile(tmpfile, "second line\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file8.log] first line\n[file8.log] second line\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write a stack trace into a log file in multiline mode. The output should see it as a single message
+func TestTailOnSingleFileWithMultiline(t *testing.T) {
+	path := "./file9.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(300 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file9.log"}, contentFilterType: "include", contentFilter: "Exception", timeout: -1, oldFiles: -1, multilinePattern: "^\\[", multilineMatch: "start", multilineTimeout: 50}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "[ERROR] temporary file's content\n")
+	writeInFile(tmpfile, "java.lang.IllegalStateException\n")
+	writeInFile(tmpfile, "\tat Main.main(Main.java:3)\n")
+	writeInFile(tmpfile, "[INFO] temporary file's content\n")
+	time.Sleep(150 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file9.log] [ERROR] temporary file's content\njava.lang.IllegalStateException\n\tat Main.main(Main.java:3)\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write json lines into a log file with the json parser. The output should see their fields
+func TestTailOnSingleFileWithJSONParser(t *testing.T) {
+	path := "./file10.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file10.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1, parser: "json", messageKey: "msg"}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "{\"level\":\"warn\",\"msg\":\"temporary file's content\"}\n")
+	writeInFile(tmpfile, "not json\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file10.log] temporary file's content level=warn\n[file10.log] not json\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write access log lines into a log file with the regex parser. The output should see their fields
+func TestTailOnSingleFileWithRegexParser(t *testing.T) {
+	path := "./file11.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file11.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1, parser: "regex", regexPattern: "^%{IP:client} (?P<msg>.*)$", messageKey: "msg"}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "10.0.0.1 temporary file's content\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file11.log] temporary file's content client=10.0.0.1\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write logfmt lines into a log file with the logfmt parser and a filter on a field. The output
+// should see the lines whose field matches
+func TestTailOnSingleFileWithLogfmtParserAndFieldFilter(t *testing.T) {
+	path := "./file12.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file12.log"}, contentFilterType: "include", contentFilter: "err", contentFilterField: "level", timeout: -1, oldFiles: -1, parser: "logfmt", messageKey: "msg"}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "level=info msg=\"temporary file's content\"\n")
+	writeInFile(tmpfile, "level=error msg=\"temporary file's content\" dur=12ms\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file12.log] temporary file's content dur=12ms level=error\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write lines with different levels into a log file with a minimum level. The output should see
+// the lines at that level or above and the ones without level
+func TestTailOnSingleFileWithMinLevel(t *testing.T) {
+	path := "./file13.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file13.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1, minLevel: tail.LevelWarn}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "[INFO] temporary file's content\n")
+	writeInFile(tmpfile, "[WARN] temporary file's content\n")
+	writeInFile(tmpfile, "temporary file's content\n")
+	writeInFile(tmpfile, "[DEBUG] temporary file's content\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file13.log] [WARN] temporary file's content\n[file13.log] temporary file's content\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write logfmt lines into a log file with a filter expression. The output should see the lines
+// matching the expression
+func TestTailOnSingleFileWithFilterExpression(t *testing.T) {
+	path := "./file14.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file14.log"}, contentFilterType: "expression", contentFilter: "(level >= warn or dur > 500ms) and not msg contains retrying", timeout: -1, oldFiles: -1, parser: "logfmt", messageKey: "msg"}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "level=info msg=\"temporary file's content\" dur=12ms\n")
+	writeInFile(tmpfile, "level=info msg=\"temporary file's content\" dur=2s\n")
+	writeInFile(tmpfile, "level=error msg=\"temporary file's content, retrying\"\n")
+	writeInFile(tmpfile, "level=error msg=\"temporary file's content\"\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file14.log] temporary file's content dur=2s level=info\n[file14.log] temporary file's content level=error\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write lines with sensitive data into a log file with redaction enabled. The output should see
+// that data masked
+func TestTailOnSingleFileWithRedaction(t *testing.T) {
+	path := "./file15.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file15.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1, redact: "email", redactRules: []string{`user=(\w+)`}}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "temporary file's content sent to jane@example.org by user=bob\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file15.log] temporary file's content sent to [REDACTED] by user=[REDACTED]\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+func TestCreateLabels(t *testing.T) {
+	os.Setenv("TF_TEST_REGION", "eu")
+	defer os.Unsetenv("TF_TEST_REGION")
+
+	labels, err := createLabels("env=prod, region=${TF_TEST_REGION}-west,zone=a", "LABEL_", []string{"LABEL_ZONE=b", "LABEL_TEAM=core", "LABEL_=x", "OTHER=y"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wanted := map[string]string{"env": "prod", "region": "eu-west", "zone": "a", "team": "core"}
+	if !reflect.DeepEqual(labels, wanted) {
+		t.Errorf("Found: %v; wanted: %v", labels, wanted)
+	}
+
+	if labels, _ := createLabels("", "", os.Environ()); labels != nil {
+		t.Errorf("Found: %v; wanted no labels", labels)
+	}
+	if _, err := createLabels("env", "", nil); err == nil {
+		t.Error("Label 'env' should be wrong")
+	}
+}
+
+func TestParseRateLimitMode(t *testing.T) {
+	if sample, err := parseRateLimitMode("sample:10"); err != nil || sample != 10 {
+		t.Errorf("Found: %d %v; wanted: 10", sample, err)
+	}
+	for _, mode := range []string{"sample:1", "sample:0", "sample:x", "keep"} {
+		if _, err := parseRateLimitMode(mode); err == nil {
+			t.Errorf("Mode '%s' should be wrong", mode)
+		}
+	}
+}
+
+// Write into a log file with a path pattern. The output should see the fields captured out of
+// the file path
+func TestTailOnSingleFileWithPathPattern(t *testing.T) {
+	path := "./file16.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file16.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1, pathPattern: `/(?P<name>[^/]+)\.log$`}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "temporary file's content\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file16.log] temporary file's content name=file16\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write docker json-file lines into a log file with the docker format. The output should see
+// the unwrapped lines along with their stream
+func TestTailOnSingleFileWithDockerFormat(t *testing.T) {
+	path := "./file17.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file17.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1, containerFormat: tail.ContainerFormatDocker}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, `{"log":"temporary file's ","stream":"stdout","time":"2019-05-05T20:26:59Z"}`+"\n")
+	writeInFile(tmpfile, `{"log":"content\n","stream":"stdout","time":"2019-05-05T20:26:59Z"}`+"\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file17.log] temporary file's content stream=stdout\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write syslog lines into a log file with the syslog parser. The output should see the fields
+// decoded out of the lines
+func TestTailOnSingleFileWithSyslogParser(t *testing.T) {
+	path := "./file18.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file18.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1, parser: "syslog"}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "<38>Oct  5 13:55:36 myhost sshd[1234]: temporary file's content\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file18.log] temporary file's content appname=sshd facility=auth hostname=myhost procid=1234 severity=info timestamp=\"Oct  5 13:55:36\"\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write more lines than allowed into a log file with a rate limit. The output should see the
+// lines within the limit
+func TestTailOnSingleFileWithRateLimit(t *testing.T) {
+	path := "./file19.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file19.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1, rateLimit: 2}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "temporary file's content\ntemporary file's content\ntemporary file's content\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file19.log] temporary file's content\n[file19.log] temporary file's content\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write repeated lines into a log file with collapsing enabled. The output should see the line
+// once followed by how many times it has been repeated
+func TestTailOnSingleFileWithCollapsedLines(t *testing.T) {
+	path := "./file20.log"
+	tmpfile, closeFunc := createFile(path)
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", expressionType: "glob", filters: []string{"file20.log"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1, collapseRepeated: 10}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "temporary file's content\ntemporary file's content\ntemporary file's content\nother content\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	defer closeFunc()
+
+	wanted := "[file20.log] temporary file's content\n[file20.log] last message repeated 2 times repeated=2\n[file20.log] other content\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write into log files in nested folders with include and exclude patterns on their paths. The
+// output should only see what is written into the included files
+func TestTailOnNestedFilesWithIncludeAndExcludePatterns(t *testing.T) {
+	folderName := "./tail_folder_test21"
+	_ = os.MkdirAll(folderName+"/app", os.ModePerm)
+	_ = os.MkdirAll(folderName+"/archive/app", os.ModePerm)
+	defer os.RemoveAll(folderName)
+	tmpfile, closeFunc1 := createFile(folderName + "/app/file21.log")
+	tmpfileArchived, closeFunc2 := createFile(folderName + "/archive/app/file21.log")
+	tmpfileOther, closeFunc3 := createFile(folderName + "/file21.log")
+	defer closeFunc1()
+	defer closeFunc2()
+	defer closeFunc3()
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", recursive: true, expressionType: "glob", filters: []string{"**/app/file21.log"}, excludes: []string{"**/archive/**"}, contentFilterType: "no-filter", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "temporary file's content\n")
+	writeInFile(tmpfileArchived, "temporary file's content\n")
+	writeInFile(tmpfileOther, "temporary file's content\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	wanted := "[tail_folder_test21/app/file21.log] temporary file's content\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write into log files in nested folders with excluded folders and a maximum depth. The output
+// should only see what is written into the files of the watched folders
+func TestTailOnNestedFilesWithExcludedFoldersAndMaxDepth(t *testing.T) {
+	folderName := "./tail_folder_test22"
+	_ = os.MkdirAll(folderName+"/app/deeper", os.ModePerm)
+	_ = os.MkdirAll(folderName+"/node_modules", os.ModePerm)
+	defer os.RemoveAll(folderName)
+	tmpfile, closeFunc1 := createFile(folderName + "/app/file22.log")
+	tmpfileDeeper, closeFunc2 := createFile(folderName + "/app/deeper/file22.log")
+	tmpfileExcluded, closeFunc3 := createFile(folderName + "/node_modules/file22.log")
+	defer closeFunc1()
+	defer closeFunc2()
+	defer closeFunc3()
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", recursive: true, expressionType: "glob", filters: []string{"file22.log"}, excludeFolders: []string{"node_modules"}, maxDepth: 2, contentFilterType: "no-filter", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "temporary file's content\n")
+	writeInFile(tmpfileDeeper, "temporary file's content\n")
+	writeInFile(tmpfileExcluded, "temporary file's content\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	wanted := "[tail_folder_test22/app/file22.log] temporary file's content\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
+
+// Write into log files in hidden folders with hidden folders included. The output should see
+// what is written into them, hidden files included, but into the folder of tail_folders' own log
+func TestTailOnHiddenFoldersWithIncludeHidden(t *testing.T) {
+	folderName := "./tail_folder_test23"
+	_ = os.MkdirAll(folderName+"/.pm2", os.ModePerm)
+	_ = os.MkdirAll(folderName+"/.logdir", os.ModePerm)
+	defer os.RemoveAll(folderName)
+	tmpfile, closeFunc1 := createFile(folderName + "/.pm2/file23.log")
+	tmpfileHidden, closeFunc2 := createFile(folderName + "/.pm2/.file23.log")
+	tmpfileLog, closeFunc3 := createFile(folderName + "/.logdir/file23.log")
+	defer closeFunc1()
+	defer closeFunc2()
+	defer closeFunc3()
+
+	sendInterruptToMyselfAfter(200 * time.Millisecond)
+
+	outWriter := tail.MakeOutStringWriter()
+	exit := runMain(func() {
+		run(config{folderPaths: ".", recursive: true, expressionType: "glob", filters: []string{"*file23.log"}, includeHidden: true, contentFilterType: "no-filter", timeout: -1, oldFiles: -1}, make([]string, 0), outWriter)
+	})
+
+	writeInFile(tmpfile, "temporary file's content\n")
+	time.Sleep(50 * time.Millisecond)
+	writeInFile(tmpfileHidden, "temporary file's content\n")
+	writeInFile(tmpfileLog, "temporary file's content\n")
+	time.Sleep(100 * time.Millisecond)
+
+	<-exit
+
+	wanted := "[tail_folder_test23/.pm2/file23.log] temporary file's content\n[tail_folder_test23/.pm2/.file23.log] temporary file's content\n"
+	if outWriter.String() != wanted {
+		t.Errorf("Found: %s; wanted: %s", outWriter.String(), wanted)
+	}
+}
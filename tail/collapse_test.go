@@ -0,0 +1,72 @@
+package tail
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollapseRepeatedLines(t *testing.T) {
+	chanOut := make(chan Entry)
+	writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF, CollapseTimeout: 50 * time.Millisecond})
+	defer writer.Close()
+
+	go func() {
+		writer.Write([]byte("ERROR one\nERROR one\nERROR one\ntwo\ntwo\nthree\nthree\nthree\n"))
+	}()
+
+	wanted := []string{"ERROR one", "last message repeated 2 times", "two", "last message repeated 1 times", "three", "last message repeated 2 times"}
+	for i, message := range wanted {
+		select {
+		case e := <-chanOut:
+			if e.Message != message {
+				t.Errorf("Found: %s; wanted: %s", e.Message, message)
+			}
+			if i == 1 && (e.Level != "error" || e.Fields["repeated"] != 2) {
+				t.Errorf("Found: %v; wanted the level and count of the repeated entry", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %s", message)
+		}
+	}
+}
+
+func TestCollapseComparesFields(t *testing.T) {
+	chanOut := make(chan Entry)
+	writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF, Parser: JSONParser("msg"), CollapseTimeout: time.Second})
+	defer writer.Close()
+
+	go writer.Write([]byte(`{"msg":"request","path":"/a","status":200}` + "\n" + `{"msg":"request","path":"/b","status":500}` + "\n"))
+
+	for _, path := range []string{"/a", "/b"} {
+		select {
+		case e := <-chanOut:
+			if e.Message != "request" || e.Fields["path"] != path {
+				t.Errorf("Found: %s %v; wanted: request with path %s", e.Message, e.Fields, path)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %s", path)
+		}
+	}
+}
+
+func TestCollapseReportsOnFlushAndClose(t *testing.T) {
+	chanOut := make(chan Entry, 10)
+	writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF, CollapseTimeout: time.Minute})
+
+	writer.Write([]byte("one\none\n"))
+	writer.Flush()
+	writer.Write([]byte("one\none\n"))
+	writer.Close()
+
+	wanted := []string{"one", "last message repeated 1 times", "last message repeated 2 times"}
+	for _, message := range wanted {
+		select {
+		case e := <-chanOut:
+			if e.Message != message {
+				t.Errorf("Found: %s; wanted: %s", e.Message, message)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %s", message)
+		}
+	}
+}
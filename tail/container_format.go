@@ -0,0 +1,189 @@
+package tail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ContainerFormat is the way container runtimes wrap the lines written by
+// containers into their log files
+type ContainerFormat int
+
+const (
+	// ContainerFormatNone means lines are not wrapped
+	ContainerFormatNone ContainerFormat = iota
+	// ContainerFormatDocker is the docker json-file format, where every line is
+	// a JSON object such as {"log":"message\n","stream":"stdout","time":"..."}
+	ContainerFormatDocker
+	// ContainerFormatCRI is the format of CRI runtimes such as containerd or
+	// cri-o, where every line is '<time> <stream> <P|F> <message>'
+	ContainerFormatCRI
+	// ContainerFormatAuto detects the format of every line
+	ContainerFormatAuto
+)
+
+// ParseContainerFormat returns the format named s: Either 'none', 'docker', 'cri' or 'auto'
+func ParseContainerFormat(s string) (ContainerFormat, error) {
+	switch s {
+	case "none", "":
+		return ContainerFormatNone, nil
+	case "docker":
+		return ContainerFormatDocker, nil
+	case "cri":
+		return ContainerFormatCRI, nil
+	case "auto":
+		return ContainerFormatAuto, nil
+	}
+	return ContainerFormatNone, fmt.Errorf("Unrecognized container format: %s", s)
+}
+
+// maxContainerRecordSize bounds the size in bytes of the records written by
+// container runtimes, which hold at most 16KiB of a line, JSON escaped by docker.
+// The maximum line size applies to the lines joined out of them instead
+const maxContainerRecordSize = 128 * 1024
+
+// containerRecord is a line unwrapped out of the container runtime format
+type containerRecord struct {
+	message string
+	stream  string
+	time    time.Time
+	// partial tells whether the message goes on in the next record
+	partial bool
+}
+
+// dockerRecord is a line written by the docker json-file logging driver
+type dockerRecord struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+func decodeDocker(s string) (containerRecord, error) {
+	var record dockerRecord
+	if err := json.Unmarshal([]byte(s), &record); err != nil {
+		return containerRecord{}, err
+	}
+	// long lines are split in records whose log does not end with a line break
+	message := strings.TrimSuffix(record.Log, "\n")
+	return containerRecord{
+		message: strings.TrimSuffix(message, "\r"),
+		stream:  record.Stream,
+		time:    record.Time,
+		partial: message == record.Log,
+	}, nil
+}
+
+func decodeCRI(s string) (containerRecord, error) {
+	parts := strings.SplitN(s, " ", 4)
+	if len(parts) < 3 {
+		return containerRecord{}, errors.New("Line is not in CRI format")
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return containerRecord{}, err
+	}
+	// the tag may hold more flags after the first one, separated by colons
+	flag := strings.SplitN(parts[2], ":", 2)[0]
+	if flag != "P" && flag != "F" {
+		return containerRecord{}, fmt.Errorf("Unrecognized CRI tag: %s", parts[2])
+	}
+	message := ""
+	if len(parts) == 4 {
+		message = parts[3]
+	}
+	return containerRecord{message: message, stream: parts[1], time: t, partial: flag == "P"}, nil
+}
+
+// containerDecoder unwraps lines out of the container runtime format and joins
+// the records of a line split by the runtime
+type containerDecoder struct {
+	format ContainerFormat
+	// maxLineSize is the maximum size in bytes of a joined line. Zero means no limit
+	maxLineSize int
+	// splitLong tells whether joined lines longer than maxLineSize are split in
+	// several lines instead of being truncated
+	splitLong bool
+	// partial is the line being joined, whose text is kept in text
+	partial *line
+	text    []byte
+	// discarding is set after truncating a joined line till its last record is found
+	discarding bool
+	// size is the amount of bytes read for the partial line
+	size int
+}
+
+func (d *containerDecoder) decode(s string) (containerRecord, error) {
+	switch d.format {
+	case ContainerFormatDocker:
+		return decodeDocker(s)
+	case ContainerFormatCRI:
+		return decodeCRI(s)
+	}
+	if strings.HasPrefix(s, "{") {
+		return decodeDocker(s)
+	}
+	return decodeCRI(s)
+}
+
+// add unwraps the line and hands the lines it completes to complete, along with
+// the amount of bytes read for them. Joined lines longer than maxLineSize are
+// either truncated or split. Lines not following the format are kept as they
+// are. It returns false if complete does
+func (d *containerDecoder) add(l line, size int, complete func(line, int) bool) bool {
+	record, err := d.decode(l.text)
+	if err == nil {
+		l.text = record.message
+		l.stream = record.stream
+		l.time = record.time
+	}
+	if d.partial == nil {
+		first := l
+		d.partial = &first
+	}
+	d.partial.truncated = d.partial.truncated || l.truncated
+	d.size += size
+	if !d.discarding {
+		d.text = append(d.text, l.text...)
+	}
+	for d.maxLineSize > 0 && len(d.text) > d.maxLineSize {
+		cut := runeCut(d.text, d.maxLineSize)
+		if !d.splitLong {
+			d.text = d.text[:cut]
+			d.partial.truncated = true
+			d.discarding = true
+			break
+		}
+		chunk := *d.partial
+		chunk.text = string(d.text[:cut])
+		d.text = append(d.text[:0], d.text[cut:]...)
+		chunkSize := d.size
+		d.size = 0
+		if !complete(chunk, chunkSize) {
+			return false
+		}
+	}
+	if err == nil && record.partial {
+		return true
+	}
+	return d.flush(complete)
+}
+
+// hasPending tells whether there is a partial line waiting to be completed
+func (d *containerDecoder) hasPending() bool {
+	return d.partial != nil
+}
+
+// flush hands the line being joined as it is to complete and starts a new one
+func (d *containerDecoder) flush(complete func(line, int) bool) bool {
+	l := *d.partial
+	l.text = string(d.text)
+	size := d.size
+	d.partial = nil
+	d.text = d.text[:0]
+	d.discarding = false
+	d.size = 0
+	return complete(l, size)
+}
@@ -0,0 +1,119 @@
+package tail
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDockerFormat(t *testing.T) {
+	chanOut := make(chan Entry)
+	writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF, ContainerFormat: ContainerFormatDocker})
+
+	go writer.Write([]byte(`{"log":"started\n","stream":"stdout","time":"2019-05-05T20:26:59.596488Z"}
+{"log":"a long ","stream":"stderr","time":"2019-05-05T20:27:00Z"}
+{"log":"line\n","stream":"stderr","time":"2019-05-05T20:27:01Z"}
+not wrapped
+`))
+
+	wanted := []struct {
+		message string
+		stream  string
+		time    string
+	}{
+		{"started", "stdout", "2019-05-05T20:26:59.596488Z"},
+		{"a long line", "stderr", "2019-05-05T20:27:00Z"},
+		{"not wrapped", "", ""},
+	}
+	for _, w := range wanted {
+		select {
+		case e := <-chanOut:
+			stream, _ := e.FieldValue("stream")
+			if e.Message != w.message || stream != w.stream {
+				t.Errorf("Found: %s (%s); wanted: %s (%s)", e.Message, stream, w.message, w.stream)
+			}
+			if w.time != "" && (e.Timestamp.Format(time.RFC3339Nano) != w.time || e.ReadTime == nil) {
+				t.Errorf("Found: %v (read at %v); wanted: %s", e.Timestamp, e.ReadTime, w.time)
+			}
+			if w.time == "" && e.ReadTime != nil {
+				t.Errorf("Found: %v; wanted read time for %s", e.ReadTime, w.message)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %s", w.message)
+		}
+	}
+}
+
+func TestCRIFormat(t *testing.T) {
+	chanOut := make(chan Entry)
+	writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF, ContainerFormat: ContainerFormatAuto})
+
+	go func() {
+		writer.Write([]byte("2019-05-05T20:26:59.596488123Z stdout F started\n"))
+		writer.Write([]byte("2019-05-05T20:27:00Z stderr P a long \n2019-05-05T20:27:01Z stderr P "))
+		writer.Write([]byte("\n2019-05-05T20:27:02Z stderr F line\n"))
+		writer.Write([]byte(`{"log":"from docker\n","stream":"stdout","time":"2019-05-05T20:27:03Z"}` + "\n"))
+	}()
+
+	for _, wanted := range []string{"started", "a long line", "from docker"} {
+		select {
+		case e := <-chanOut:
+			if e.Message != wanted {
+				t.Errorf("Found: %s; wanted: %s", e.Message, wanted)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %s", wanted)
+		}
+	}
+}
+
+func TestCRIPartialLineIsPending(t *testing.T) {
+	chanOut := make(chan Entry, 1)
+	line := "2019-05-05T20:27:00Z stdout P partial\n"
+	writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF, ContainerFormat: ContainerFormatCRI})
+
+	writer.Write([]byte(line))
+	if pending := writer.pendingLen(); pending != len(line) {
+		t.Errorf("Found: %d; wanted: %d pending bytes", pending, len(line))
+	}
+	writer.Flush()
+	if e := <-chanOut; e.Message != "partial" {
+		t.Errorf("Found: %s; wanted: partial", e.Message)
+	}
+	if pending := writer.pendingLen(); pending != 0 {
+		t.Errorf("Found: %d; wanted no pending bytes", pending)
+	}
+}
+
+func TestParseContainerFormat(t *testing.T) {
+	if format, err := ParseContainerFormat("cri"); err != nil || format != ContainerFormatCRI {
+		t.Errorf("Found: %v %v; wanted: %v", format, err, ContainerFormatCRI)
+	}
+	if _, err := ParseContainerFormat("podman"); err == nil {
+		t.Error("Format 'podman' should be wrong")
+	}
+}
+
+func TestCRIPartialLinesAreCapped(t *testing.T) {
+	records := "2019-05-05T20:27:00Z stdout P 0123456789\n2019-05-05T20:27:01Z stdout P abcdefghij\n2019-05-05T20:27:02Z stdout F ABCDE\nnext\n"
+	for _, split := range []bool{false, true} {
+		chanOut := make(chan Entry)
+		config := Config{Accept: acceptF, ContainerFormat: ContainerFormatCRI, MaxLineSize: 8, SplitLongLines: split}
+		writer, _ := lineProcessorWriter(Tag, chanOut, config)
+		go writer.Write([]byte(records))
+
+		wanted := []Entry{{Message: "01234567", Truncated: true}, {Message: "next"}}
+		if split {
+			wanted = []Entry{{Message: "01234567"}, {Message: "89abcdef"}, {Message: "ghijABCD"}, {Message: "E"}, {Message: "next"}}
+		}
+		for _, w := range wanted {
+			select {
+			case e := <-chanOut:
+				if e.Message != w.Message || e.Truncated != w.Truncated {
+					t.Errorf("Found: %s (truncated %v); wanted: %s (truncated %v)", e.Message, e.Truncated, w.Message, w.Truncated)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("Timeout waiting for %s", w.Message)
+			}
+		}
+	}
+}
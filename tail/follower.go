@@ -0,0 +1,269 @@
+package tail
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oscar-martin/tail_folders/checkpoint"
+	"github.com/oscar-martin/tail_folders/logger"
+)
+
+const (
+	// pollInterval is the time to wait for checking a file for new content
+	// when no write notification has been received
+	pollInterval   = 250 * time.Millisecond
+	readBufferSize = 32 * 1024
+)
+
+// rotationGrace is the time the old file must stay idle before switching to
+// the new one on rotation, as writers keep appending to the old file till they
+// reopen it, e.g. when logrotate signals them after creating the new one
+const rotationGrace = time.Second
+
+// Follower reads a file as it grows and writes its content into a line
+// processor. Callers can speed up reading by notifying writes on the file.
+// It survives log rotation: when the path is renamed and created again, the
+// old file is read till it stays idle before switching to the new one, and when
+// the file is truncated in place (copytruncate) it is read again from the start
+type Follower struct {
+	filename   string
+	file       *os.File
+	offset     int64
+	lp         *lineProcessor
+	registry   *checkpoint.Registry
+	checkpoint checkpoint.Checkpoint
+	notifyChan chan struct{}
+	stopChan   chan struct{}
+	doneChan   chan struct{}
+	stopOnce   sync.Once
+
+	// acceptRotation tells whether to switch to the new file on rotation
+	acceptRotation func(string, os.FileInfo) bool
+	// rotatedOffset is the offset of the old file when it was last seen growing
+	// after a new file has been created in its place, at rotatedTime
+	rotatedOffset int64
+	rotatedTime   time.Time
+}
+
+func newFollower(filename string, lp *lineProcessor, resume bool, start StartPosition, registry *checkpoint.Registry, acceptRotation func(string, os.FileInfo) bool) (*Follower, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	f := &Follower{
+		filename:       filename,
+		file:           file,
+		lp:             lp,
+		registry:       registry,
+		acceptRotation: acceptRotation,
+		notifyChan:     make(chan struct{}, 1),
+		stopChan:       make(chan struct{}),
+		doneChan:       make(chan struct{}),
+	}
+
+	offset, err := f.startOffset(resume, start)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if f.offset, err = file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := f.resetCheckpoint(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// startOffset returns the offset stored in the registry for the file when it
+// must be resumed. A file not matching its stored checkpoint has replaced the
+// one it was taken from, so it is read from its start. Otherwise, the file is
+// followed from the start position
+func (f *Follower) startOffset(resume bool, start StartPosition) (int64, error) {
+	if resume && f.registry != nil {
+		if c, ok := f.registry.Get(f.filename); ok {
+			if c.Matches(f.file) {
+				logger.Info.Printf("Resuming tailing '%s' at offset %d\n", f.filename, c.Offset)
+				return c.Offset, nil
+			}
+			logger.Info.Printf("Checkpoint for '%s' does not match the file. Reading it from the start\n", f.filename)
+			return 0, nil
+		}
+	}
+	return start.offset(f.file)
+}
+
+// resetCheckpoint takes a new checkpoint for the current file and offset
+func (f *Follower) resetCheckpoint() error {
+	if f.registry == nil {
+		return nil
+	}
+	c, err := checkpoint.NewCheckpoint(f.filename, f.file, f.offset)
+	if err != nil {
+		return err
+	}
+	f.checkpoint = c
+	f.registry.Set(c)
+	return nil
+}
+
+// commitCheckpoint stores the offset of the last line that has been processed
+func (f *Follower) commitCheckpoint() error {
+	if f.registry == nil {
+		return nil
+	}
+	if err := f.checkpoint.Update(f.file, f.offset-int64(f.lp.pendingLen())); err != nil {
+		return err
+	}
+	f.registry.Set(f.checkpoint)
+	return nil
+}
+
+// Notify lets the follower know the file has been written, renamed or
+// created again. It never blocks
+func (f *Follower) Notify() {
+	select {
+	case f.notifyChan <- struct{}{}:
+	default:
+	}
+}
+
+// Stop terminates following the file and waits till it is done
+func (f *Follower) Stop() {
+	f.stopOnce.Do(func() {
+		close(f.stopChan)
+		// unblocks the follower in case it is waiting for delivering an entry
+		f.lp.Close()
+	})
+	<-f.doneChan
+}
+
+func (f *Follower) run() {
+	defer close(f.doneChan)
+	// the file is replaced on rotation, so it must be evaluated on exit
+	defer func() {
+		f.file.Close()
+	}()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	buf := make([]byte, readBufferSize)
+	for {
+		err := f.readToEOF(buf)
+		if err == nil {
+			// committed on every wake up, as joined messages may be sent by a timer
+			err = f.commitCheckpoint()
+		}
+		if err == nil {
+			var rotated bool
+			rotated, err = f.checkRotation()
+			if err == nil && rotated {
+				// read the new file straight away
+				continue
+			}
+		}
+		if err != nil {
+			select {
+			case <-f.stopChan:
+			default:
+				logger.Warning.Printf("%s -> %v\n", f.filename, err)
+			}
+			return
+		}
+		select {
+		case <-f.notifyChan:
+		case <-ticker.C:
+		case <-f.stopChan:
+			return
+		}
+	}
+}
+
+func (f *Follower) readToEOF(buf []byte) error {
+	for {
+		n, err := f.file.Read(buf)
+		if n > 0 {
+			f.offset += int64(n)
+			if _, werr := f.lp.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// checkRotation detects whether the file has been truncated or replaced by a
+// new one since it was opened. Both cases make the follower read from the start
+// of the current file. It must be called once the file has been read till EOF
+func (f *Follower) checkRotation() (bool, error) {
+	current, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if current.Size() < f.offset {
+		logger.Info.Printf("File '%s' has been truncated. Reading it from the start\n", f.filename)
+		if err := f.lp.Flush(); err != nil {
+			return false, err
+		}
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		f.offset = 0
+		return true, f.resetCheckpoint()
+	}
+
+	latest, err := os.Stat(f.filename)
+	if err != nil {
+		// the file has been renamed or removed and nothing has been created
+		// in its place yet. Keep on reading the old one meanwhile
+		return false, nil
+	}
+	if os.SameFile(current, latest) {
+		f.rotatedTime = time.Time{}
+		return false, nil
+	}
+	if f.rotatedTime.IsZero() || f.offset != f.rotatedOffset {
+		// the old file may still be written till its writer reopens the path
+		f.rotatedOffset = f.offset
+		f.rotatedTime = time.Now()
+		return false, nil
+	}
+	if time.Since(f.rotatedTime) < rotationGrace {
+		return false, nil
+	}
+
+	if f.acceptRotation != nil && !f.acceptRotation(f.filename, latest) {
+		if err := f.lp.Flush(); err != nil {
+			return false, err
+		}
+		return false, errors.New("Path has been replaced by a file followed through another path")
+	}
+	file, err := os.Open(f.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	logger.Info.Printf("File '%s' has been rotated. Following the new one\n", f.filename)
+	if err := f.lp.Flush(); err != nil {
+		file.Close()
+		return false, err
+	}
+	f.file.Close()
+	f.file = file
+	f.offset = 0
+	f.rotatedTime = time.Time{}
+	return true, f.resetCheckpoint()
+}
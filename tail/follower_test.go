@@ -0,0 +1,337 @@
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oscar-martin/tail_folders/checkpoint"
+)
+
+func TestFollowerSkipsExistingContent(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+
+	if _, err := tmpfile.Write([]byte("old line\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	chanOut := make(chan Entry)
+	follower, err := DoTail(tmpfile.Name(), chanOut, false, Config{Accept: acceptF})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop()
+
+	if _, err := tmpfile.Write([]byte("new line\n")); err != nil {
+		t.Fatal(err)
+	}
+	follower.Notify()
+
+	select {
+	case e := <-chanOut:
+		if e.Message != "new line" {
+			t.Errorf("Found: %s; wanted: %s", e.Message, "new line")
+		}
+	case <-time.After(time.Second):
+		t.Error("Timeout waiting for new line")
+	}
+}
+
+func TestFollowerStopWhileDelivering(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+
+	// nobody reads from this channel, so the follower gets blocked delivering
+	chanOut := make(chan Entry)
+	follower, err := DoTail(tmpfile.Name(), chanOut, false, Config{Accept: acceptF})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tmpfile.Write([]byte("one\ntwo\n")); err != nil {
+		t.Fatal(err)
+	}
+	follower.Notify()
+	time.Sleep(50 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		follower.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("Follower did not stop")
+	}
+}
+
+// waitForMessage waits long enough for the follower to switch files on rotation
+func waitForMessage(t *testing.T, c <-chan Entry, wanted string) {
+	select {
+	case e := <-c:
+		if e.Message != wanted {
+			t.Errorf("Found: %s; wanted: %s", e.Message, wanted)
+		}
+	case <-time.After(rotationGrace + time.Second):
+		t.Errorf("Timeout waiting for %s", wanted)
+	}
+}
+
+func TestFollowerRenameAndCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chanOut := make(chan Entry)
+	follower, err := DoTail(path, chanOut, false, Config{Accept: acceptF})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop()
+
+	// the line written before creating the new file must not be lost
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte("before rotation\n")); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	newFile, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newFile.Close()
+	if _, err := newFile.Write([]byte("after rotation\n")); err != nil {
+		t.Fatal(err)
+	}
+	follower.Notify()
+
+	waitForMessage(t, chanOut, "before rotation")
+	waitForMessage(t, chanOut, "after rotation")
+}
+
+func TestFollowerCopyTruncate(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+
+	chanOut := make(chan Entry)
+	follower, err := DoTail(tmpfile.Name(), chanOut, false, Config{Accept: acceptF})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop()
+
+	if _, err := tmpfile.Write([]byte("a quite long line before truncating\n")); err != nil {
+		t.Fatal(err)
+	}
+	follower.Notify()
+	waitForMessage(t, chanOut, "a quite long line before truncating")
+
+	if err := tmpfile.Truncate(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpfile.WriteAt([]byte("short\n"), 0); err != nil {
+		t.Fatal(err)
+	}
+	follower.Notify()
+	waitForMessage(t, chanOut, "short")
+}
+
+func TestFollowerResumesFromCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	registry, err := checkpoint.Load(filepath.Join(dir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Accept: acceptF, Registry: registry}
+
+	chanOut := make(chan Entry)
+	follower, err := DoTail(path, chanOut, true, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte("read\n")); err != nil {
+		t.Fatal(err)
+	}
+	follower.Notify()
+	waitForMessage(t, chanOut, "read")
+	follower.Stop()
+
+	// written while not following the file
+	if _, err := file.Write([]byte("missed\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	follower, err = DoTail(path, chanOut, true, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop()
+	waitForMessage(t, chanOut, "missed")
+}
+
+func TestFollowerWritesAfterCreate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	chanOut := make(chan Entry)
+	follower, err := DoTail(path, chanOut, false, Config{Accept: acceptF})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop()
+
+	if _, err := file.Write([]byte("one\n")); err != nil {
+		t.Fatal(err)
+	}
+	follower.Notify()
+	waitForMessage(t, chanOut, "one")
+
+	// the writer keeps appending to the old file till it reopens the path
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	newFile, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newFile.Close()
+	follower.Notify()
+	time.Sleep(2 * pollInterval)
+	if _, err := file.Write([]byte("two\n")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newFile.Write([]byte("three\n")); err != nil {
+		t.Fatal(err)
+	}
+	follower.Notify()
+
+	waitForMessage(t, chanOut, "two")
+	waitForMessage(t, chanOut, "three")
+}
+
+func TestFollowerReadsReplacedFileFromStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(path, []byte("a quite long line being read\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := checkpoint.Load(filepath.Join(dir, "registry.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Accept: acceptF, Registry: registry}
+
+	chanOut := make(chan Entry)
+	follower, err := DoTail(path, chanOut, true, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	follower.Stop()
+
+	// rotated while not following the file
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("missed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	follower, err = DoTail(path, chanOut, true, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop()
+	waitForMessage(t, chanOut, "missed")
+}
+
+func TestFollowerRotationNotAccepted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "follower")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chanOut := make(chan Entry)
+	config := Config{Accept: acceptF, AcceptRotation: func(string, os.FileInfo) bool { return false }}
+	follower, err := DoTail(path, chanOut, false, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer follower.Stop()
+
+	// the new file is followed through another path, so it must not be read
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte("followed elsewhere\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	follower.Notify()
+
+	select {
+	case e := <-chanOut:
+		t.Errorf("Found: %s; wanted nothing", e.Message)
+	case <-time.After(rotationGrace + time.Second):
+	}
+}
@@ -0,0 +1,14 @@
+package tail
+
+import "regexp"
+
+// KubernetesPathPattern captures the metadata of pods out of the paths of
+// their log files, as written by the kubelet into:
+//
+//   - /var/log/pods/<namespace>_<pod>_<pod_uid>/<container>/<restart_count>.log
+//   - /var/log/containers/<pod>_<namespace>_<container>-<container_id>.log
+//
+// It can be used as Config.PathPattern
+var KubernetesPathPattern = regexp.MustCompile(
+	`/pods/(?P<namespace>[^_/]+)_(?P<pod>[^_/]+)_(?P<pod_uid>[0-9a-fA-F-]+)/(?P<container>[^/]+)/\d+\.log` +
+		`|/containers/(?P<pod>[^_/]+)_(?P<namespace>[^_/]+)_(?P<container>[^/]+)-(?P<container_id>[0-9a-f]{64})\.log$`)
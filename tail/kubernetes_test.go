@@ -0,0 +1,33 @@
+package tail
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKubernetesPathPattern(t *testing.T) {
+	containerID := "4c5e3a3f0a6b8d9e1f2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f80"
+	tests := []struct {
+		path   string
+		wanted map[string]interface{}
+	}{
+		{
+			"/var/log/pods/default_web-7d4b9c-x2x5k_0b5c7a1e-2f3d-4e5f-8a9b-0c1d2e3f4a5b/nginx/0.log",
+			map[string]interface{}{"namespace": "default", "pod": "web-7d4b9c-x2x5k", "pod_uid": "0b5c7a1e-2f3d-4e5f-8a9b-0c1d2e3f4a5b", "container": "nginx"},
+		},
+		{
+			"/var/log/pods/kube-system_coredns-abc_0b5c7a1e-2f3d-4e5f-8a9b-0c1d2e3f4a5b/coredns/3.log.20201010-101010",
+			map[string]interface{}{"namespace": "kube-system", "pod": "coredns-abc", "pod_uid": "0b5c7a1e-2f3d-4e5f-8a9b-0c1d2e3f4a5b", "container": "coredns"},
+		},
+		{
+			"/var/log/containers/web-7d4b9c-x2x5k_default_nginx-" + containerID + ".log",
+			map[string]interface{}{"namespace": "default", "pod": "web-7d4b9c-x2x5k", "container": "nginx", "container_id": containerID},
+		},
+		{"/var/log/syslog.log", nil},
+	}
+	for _, test := range tests {
+		if found := pathFields(test.path, KubernetesPathPattern); !reflect.DeepEqual(found, test.wanted) {
+			t.Errorf("Found: %v; wanted: %v for %s", found, test.wanted, test.path)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package tail
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Level is the severity of an entry
+type Level int
+
+// Known levels, from the least to the most severe
+const (
+	LevelUnknown Level = iota
+	LevelTrace
+	LevelDebug
+	LevelInfo
+	LevelWarn
+	LevelError
+	LevelFatal
+)
+
+var levelNames = []string{"", "trace", "debug", "info", "warn", "error", "fatal"}
+
+// levelAliases maps the usual ways of naming levels to them
+var levelAliases = map[string]Level{
+	"trace":     LevelTrace,
+	"debug":     LevelDebug,
+	"info":      LevelInfo,
+	"notice":    LevelInfo,
+	"warn":      LevelWarn,
+	"warning":   LevelWarn,
+	"error":     LevelError,
+	"err":       LevelError,
+	"severe":    LevelError,
+	"fatal":     LevelFatal,
+	"crit":      LevelFatal,
+	"critical":  LevelFatal,
+	"alert":     LevelFatal,
+	"emerg":     LevelFatal,
+	"emergency": LevelFatal,
+	"panic":     LevelFatal,
+}
+
+// levelFields are the parsed fields that usually hold the level
+var levelFields = []string{"level", "lvl", "severity", "loglevel"}
+
+// levelToken finds levels written in upper case as a word within messages
+var levelToken = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|ERR|SEVERE|FATAL|CRIT|CRITICAL|ALERT|EMERG|PANIC)\b`)
+
+func (l Level) String() string {
+	if l < LevelUnknown || int(l) >= len(levelNames) {
+		return ""
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns the level named s, e.g. 'info' or 'WARNING'
+func ParseLevel(s string) (Level, error) {
+	if level, ok := levelAliases[strings.ToLower(s)]; ok {
+		return level, nil
+	}
+	return LevelUnknown, fmt.Errorf("Unrecognized level: %s", s)
+}
+
+// numericLevel maps numeric levels, as written by bunyan or pino, to levels
+func numericLevel(s string) Level {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return LevelUnknown
+	}
+	switch {
+	case n >= 60:
+		return LevelFatal
+	case n >= 50:
+		return LevelError
+	case n >= 40:
+		return LevelWarn
+	case n >= 30:
+		return LevelInfo
+	case n >= 20:
+		return LevelDebug
+	case n >= 10:
+		return LevelTrace
+	}
+	return LevelUnknown
+}
+
+// detectLevel finds the level of the entry in its parsed fields or, when they
+// do not have it, in its message
+func detectLevel(e Entry) Level {
+	for _, field := range levelFields {
+		if value, ok := e.FieldValue(field); ok {
+			if level, err := ParseLevel(value); err == nil {
+				return level
+			}
+			if level := numericLevel(value); level != LevelUnknown {
+				return level
+			}
+		}
+	}
+	if token := levelToken.FindString(e.Message); token != "" {
+		level, _ := ParseLevel(token)
+		return level
+	}
+	return LevelUnknown
+}
@@ -0,0 +1,64 @@
+package tail
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDetectLevel(t *testing.T) {
+	tests := []struct {
+		entry  Entry
+		wanted Level
+	}{
+		{Entry{Message: "[WARN] disk almost full"}, LevelWarn},
+		{Entry{Message: "2019-05-05 ERROR something failed"}, LevelError},
+		{Entry{Message: "an error in lower case is not a level"}, LevelUnknown},
+		{Entry{Message: "INFORMATION is not a level"}, LevelUnknown},
+		{Entry{Message: "ERROR in message", Fields: map[string]interface{}{"level": "debug"}}, LevelDebug},
+		{Entry{Fields: map[string]interface{}{"severity": "Critical"}}, LevelFatal},
+		{Entry{Fields: map[string]interface{}{"level": json.Number("40")}}, LevelWarn},
+		{Entry{Fields: map[string]interface{}{"lvl": "noise"}, Message: "TRACE"}, LevelTrace},
+	}
+	for _, test := range tests {
+		if found := detectLevel(test.entry); found != test.wanted {
+			t.Errorf("Found: %v; wanted: %v for %v", found, test.wanted, test.entry)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	if level, err := ParseLevel("WARNING"); err != nil || level != LevelWarn {
+		t.Errorf("Found: %v %v; wanted: %v", level, err, LevelWarn)
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("Level 'loud' should be wrong")
+	}
+}
+
+func TestMinLevel(t *testing.T) {
+	chanOut := make(chan Entry)
+	writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF, MinLevel: LevelWarn})
+
+	go writer.Write([]byte("DEBUG one\nWARN two\nthree\nINFO four\nERROR five\n"))
+
+	entries := []Entry{}
+	for {
+		select {
+		case e := <-chanOut:
+			entries = append(entries, e)
+			continue
+		case <-time.After(100 * time.Millisecond):
+		}
+		break
+	}
+	wanted := []Entry{{Message: "WARN two", Level: "warn"}, {Message: "three"}, {Message: "ERROR five", Level: "error"}}
+	if len(entries) != len(wanted) {
+		t.Fatalf("Found: %v; wanted: %v", entries, wanted)
+	}
+	for i := range entries {
+		if entries[i].Message != wanted[i].Message || entries[i].Level != wanted[i].Level {
+			t.Errorf("Found: %v; wanted: %v", entries[i], wanted[i])
+		}
+	}
+}
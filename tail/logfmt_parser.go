@@ -0,0 +1,97 @@
+package tail
+
+import (
+	"errors"
+	"strconv"
+)
+
+// LogfmtParser decodes messages made of key=value pairs into fields. Values
+// can be quoted when they contain spaces. When there is a key named
+// messageKey, its value becomes the message of the entry. Otherwise, the
+// message is kept, as it may be plain text holding some pairs, and keys
+// without value are discarded as they are likely its words
+func LogfmtParser(messageKey string) Parser {
+	return func(e *Entry) error {
+		fields, bareKeys, err := parseLogfmt(e.Message)
+		if err != nil {
+			return err
+		}
+		if value, ok := fields[messageKey].(string); ok && messageKey != "" {
+			e.Message = value
+			delete(fields, messageKey)
+		} else {
+			for key := range bareKeys {
+				delete(fields, key)
+			}
+		}
+		e.addFields(fields)
+		return nil
+	}
+}
+
+// parseLogfmt returns the pairs in s along with the keys found without value
+func parseLogfmt(s string) (map[string]interface{}, map[string]bool, error) {
+	fields := map[string]interface{}{}
+	bareKeys := map[string]bool{}
+	pairs := 0
+	for i := 0; i < len(s); {
+		// skip spaces between pairs
+		if s[i] == ' ' || s[i] == '\t' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && s[i] != '=' && s[i] != ' ' && s[i] != '\t' {
+			if s[i] == '"' {
+				return nil, nil, errors.New("Quote found in a logfmt key")
+			}
+			i++
+		}
+		key := s[start:i]
+		if i == len(s) || s[i] != '=' {
+			// a key without value
+			if _, ok := fields[key]; !ok {
+				fields[key] = ""
+				bareKeys[key] = true
+			}
+			continue
+		}
+		i++
+		pairs++
+		delete(bareKeys, key)
+
+		if i < len(s) && s[i] == '"' {
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, nil, errors.New("Unterminated quoted logfmt value")
+			}
+			value, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, nil, err
+			}
+			fields[key] = value
+			i = end + 1
+			continue
+		}
+
+		start = i
+		for i < len(s) && s[i] != ' ' && s[i] != '\t' {
+			i++
+		}
+		fields[key] = s[start:i]
+	}
+	if pairs == 0 {
+		return nil, nil, errors.New("Message has no logfmt pairs")
+	}
+	if _, ok := fields[""]; ok {
+		return nil, nil, errors.New("Empty logfmt key")
+	}
+	return fields, bareKeys, nil
+}
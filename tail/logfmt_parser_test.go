@@ -0,0 +1,68 @@
+package tail
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLogfmtParser(t *testing.T) {
+	e := Entry{Message: `level=info msg="request served" dur=12ms path=/index.html debug`}
+	if err := LogfmtParser("msg")(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Message != "request served" {
+		t.Errorf("Found: %s; wanted: %s", e.Message, "request served")
+	}
+	wanted := map[string]interface{}{"level": "info", "dur": "12ms", "path": "/index.html", "debug": ""}
+	if !reflect.DeepEqual(e.Fields, wanted) {
+		t.Errorf("Found: %v; wanted: %v", e.Fields, wanted)
+	}
+}
+
+func TestLogfmtParserEscapedQuotes(t *testing.T) {
+	e := Entry{Message: `err="file \"a.txt\" not found" code=2`}
+	if err := LogfmtParser("msg")(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Fields["err"] != `file "a.txt" not found` || e.Fields["code"] != "2" {
+		t.Errorf("Found: %v", e.Fields)
+	}
+}
+
+func TestLogfmtParserFailures(t *testing.T) {
+	for _, message := range []string{"just some text", `msg="unterminated`, `=value`, `ke"y=value`} {
+		e := Entry{Message: message}
+		if err := LogfmtParser("msg")(&e); err == nil {
+			t.Errorf("Parsing '%s' should fail, found %v", message, e.Fields)
+		}
+	}
+}
+
+func TestFilterOnField(t *testing.T) {
+	chanOut := make(chan Entry)
+	config := Config{
+		Accept:      func(value string) bool { return value == "error" },
+		Parser:      LogfmtParser("msg"),
+		FilterField: "level",
+	}
+	writer, _ := lineProcessorWriter(Tag, chanOut, config)
+
+	go writer.Write([]byte("level=info msg=one\nlevel=error msg=two\nno fields\n"))
+
+	messages := receiveMessages(chanOut, 100*time.Millisecond)
+	assertMessages(t, messages, []string{"two"})
+}
+
+func TestLogfmtParserWithoutMessageKey(t *testing.T) {
+	message := "Starting server on port=8080 with config url=postgres://x"
+	e := Entry{Message: message}
+	if err := LogfmtParser("msg")(&e); err != nil {
+		t.Fatal(err)
+	}
+	// words of the text are not taken as keys without value
+	wanted := map[string]interface{}{"port": "8080", "url": "postgres://x"}
+	if e.Message != message || !reflect.DeepEqual(e.Fields, wanted) {
+		t.Errorf("Found: %s %v; wanted: %s %v", e.Message, e.Fields, message, wanted)
+	}
+}
@@ -0,0 +1,73 @@
+package tail
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Multiline tells how to join related lines, e.g. stack traces, into a single
+// message
+type Multiline struct {
+	// Pattern matches either the first line of a message or its continuation
+	// lines, depending on Continuation
+	Pattern *regexp.Regexp
+	// Continuation tells whether Pattern matches continuation lines instead of
+	// first lines
+	Continuation bool
+	// MaxLines is the maximum amount of lines joined in a message. Zero means no limit
+	MaxLines int
+	// FlushTimeout is the time to wait for more lines before sending a message
+	FlushTimeout time.Duration
+}
+
+// multilineAggregator keeps the lines of the message being joined
+type multilineAggregator struct {
+	config    *Multiline
+	lines     []string
+	truncated bool
+	// first is the first line of the message, whose stream and time are kept
+	first line
+	// size is the amount of bytes read for the lines, including line breaks
+	size int
+}
+
+func (a *multilineAggregator) isContinuation(line string) bool {
+	if a.config.Continuation {
+		return a.config.Pattern.MatchString(line)
+	}
+	return !a.config.Pattern.MatchString(line)
+}
+
+// add appends the line to the message being joined. It returns the messages
+// that have been completed by the line
+func (a *multilineAggregator) add(l line, size int) []line {
+	var completed []line
+	if len(a.lines) > 0 && !a.isContinuation(l.text) {
+		completed = append(completed, a.flush())
+	}
+	if len(a.lines) == 0 {
+		a.first = l
+	}
+	a.lines = append(a.lines, l.text)
+	a.truncated = a.truncated || l.truncated
+	a.size += size
+	if a.config.MaxLines > 0 && len(a.lines) >= a.config.MaxLines {
+		completed = append(completed, a.flush())
+	}
+	return completed
+}
+
+// hasPending tells whether there are lines waiting to be sent
+func (a *multilineAggregator) hasPending() bool {
+	return len(a.lines) > 0
+}
+
+// flush returns the message made of the joined lines and starts a new one
+func (a *multilineAggregator) flush() line {
+	message := line{text: strings.Join(a.lines, "\n"), truncated: a.truncated, stream: a.first.stream, time: a.first.time}
+	a.lines = nil
+	a.truncated = false
+	a.size = 0
+	return message
+}
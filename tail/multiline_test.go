@@ -0,0 +1,92 @@
+package tail
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func receiveMessages(c <-chan Entry, wait time.Duration) []string {
+	messages := []string{}
+	for {
+		select {
+		case e := <-c:
+			messages = append(messages, e.Message)
+		case <-time.After(wait):
+			return messages
+		}
+	}
+}
+
+func assertMessages(t *testing.T, found, wanted []string) {
+	if len(found) != len(wanted) {
+		t.Fatalf("Found: %q; wanted: %q", found, wanted)
+	}
+	for i := range found {
+		if found[i] != wanted[i] {
+			t.Errorf("Found: %q; wanted: %q", found, wanted)
+		}
+	}
+}
+
+func TestMultilineStartPattern(t *testing.T) {
+	chanOut := make(chan Entry)
+	config := Config{
+		Accept:    acceptF,
+		Multiline: &Multiline{Pattern: regexp.MustCompile(`^\[`), FlushTimeout: 50 * time.Millisecond},
+	}
+	writer, _ := lineProcessorWriter("app.log", chanOut, config)
+
+	go writer.Write([]byte("[ERROR] boom\njava.lang.NullPointerException\n\tat Main.main(Main.java:3)\n[INFO] next\n"))
+
+	messages := receiveMessages(chanOut, 200*time.Millisecond)
+	assertMessages(t, messages, []string{
+		"[ERROR] boom\njava.lang.NullPointerException\n\tat Main.main(Main.java:3)",
+		"[INFO] next",
+	})
+}
+
+func TestMultilineContinuationPattern(t *testing.T) {
+	chanOut := make(chan Entry)
+	config := Config{
+		Accept:    acceptF,
+		Multiline: &Multiline{Pattern: regexp.MustCompile(`^\s`), Continuation: true, FlushTimeout: 50 * time.Millisecond},
+	}
+	writer, _ := lineProcessorWriter("app.log", chanOut, config)
+
+	go writer.Write([]byte("Traceback:\n  File \"a.py\"\n  File \"b.py\"\nValueError\n"))
+
+	messages := receiveMessages(chanOut, 200*time.Millisecond)
+	assertMessages(t, messages, []string{
+		"Traceback:\n  File \"a.py\"\n  File \"b.py\"",
+		"ValueError",
+	})
+}
+
+func TestMultilineMaxLines(t *testing.T) {
+	chanOut := make(chan Entry)
+	config := Config{
+		Accept:    acceptF,
+		Multiline: &Multiline{Pattern: regexp.MustCompile(`^\s`), Continuation: true, MaxLines: 2},
+	}
+	writer, _ := lineProcessorWriter("app.log", chanOut, config)
+
+	go writer.Write([]byte("one\n two\n three\nfour\n"))
+
+	messages := receiveMessages(chanOut, 200*time.Millisecond)
+	assertMessages(t, messages, []string{"one\n two", " three"})
+}
+
+func TestMultilineFilterAppliesToJoinedMessage(t *testing.T) {
+	chanOut := make(chan Entry)
+	config := Config{
+		Accept:    func(msg string) bool { return regexp.MustCompile(`Exception`).MatchString(msg) },
+		Multiline: &Multiline{Pattern: regexp.MustCompile(`^\[`), FlushTimeout: 50 * time.Millisecond},
+	}
+	writer, _ := lineProcessorWriter("app.log", chanOut, config)
+
+	go writer.Write([]byte("[ERROR] boom\nException\n[INFO] fine\n"))
+
+	messages := receiveMessages(chanOut, 200*time.Millisecond)
+	assertMessages(t, messages, []string{"[ERROR] boom\nException"})
+}
@@ -0,0 +1,40 @@
+package tail
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// Parser extracts structured fields out of the message of an entry. When the
+// message does not follow the expected format, it returns an error and the
+// entry is kept untouched
+type Parser func(e *Entry) error
+
+// JSONParser decodes messages made of a JSON object into fields. When the
+// object holds a string under messageKey, it becomes the message of the entry.
+// Otherwise, the line is kept as the message, so content filters still apply
+func JSONParser(messageKey string) Parser {
+	return func(e *Entry) error {
+		trimmed := strings.TrimSpace(e.Message)
+		if !strings.HasPrefix(trimmed, "{") {
+			return errors.New("Message is not a JSON object")
+		}
+		fields := map[string]interface{}{}
+		decoder := json.NewDecoder(strings.NewReader(trimmed))
+		decoder.UseNumber()
+		if err := decoder.Decode(&fields); err != nil {
+			return err
+		}
+		if _, err := decoder.Token(); err != io.EOF {
+			return errors.New("Message has trailing data after the JSON object")
+		}
+		if value, ok := fields[messageKey].(string); ok && messageKey != "" {
+			e.Message = value
+			delete(fields, messageKey)
+		}
+		e.addFields(fields)
+		return nil
+	}
+}
@@ -0,0 +1,43 @@
+package tail
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSONParser(t *testing.T) {
+	e := Entry{Message: `{"msg":"started","level":"info","port":8080,"tags":["a"]}`}
+	if err := JSONParser("msg")(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Message != "started" {
+		t.Errorf("Found: %s; wanted: %s", e.Message, "started")
+	}
+	wanted := map[string]interface{}{"level": "info", "port": json.Number("8080"), "tags": []interface{}{"a"}}
+	if !reflect.DeepEqual(e.Fields, wanted) {
+		t.Errorf("Found: %v; wanted: %v", e.Fields, wanted)
+	}
+}
+
+func TestJSONParserWithoutMessageKey(t *testing.T) {
+	e := Entry{Message: `{"level":"info"}`}
+	if err := JSONParser("msg")(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Message != `{"level":"info"}` || e.Fields["level"] != "info" {
+		t.Errorf("Found: %s %v", e.Message, e.Fields)
+	}
+}
+
+func TestJSONParserFallback(t *testing.T) {
+	for _, message := range []string{"plain text", `{"broken":`, `["not", "an", "object"]`, `{"msg":"a"} trailing garbage`, `{"a":1}{"b":2}`} {
+		chanOut := make(chan Entry)
+		writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF, Parser: JSONParser("msg")})
+		go writer.Write([]byte(message + "\n"))
+		e := <-chanOut
+		if e.Message != message || e.Fields != nil {
+			t.Errorf("Found: %s %v; wanted: %s", e.Message, e.Fields, message)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package tail
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type positionKind int
+
+const (
+	fromEnd positionKind = iota
+	fromBeginning
+	fromLastLines
+)
+
+// StartPosition tells where to start following a file. The zero value
+// follows it from its end
+type StartPosition struct {
+	kind  positionKind
+	lines int
+}
+
+// ParseStartPosition creates a StartPosition out of 'beginning', 'end' or
+// 'last:N', where N is the amount of lines to read from the end of the file
+func ParseStartPosition(s string) (StartPosition, error) {
+	switch {
+	case s == "beginning":
+		return StartPosition{kind: fromBeginning}, nil
+	case s == "end":
+		return StartPosition{kind: fromEnd}, nil
+	case strings.HasPrefix(s, "last:"):
+		lines, err := strconv.Atoi(strings.TrimPrefix(s, "last:"))
+		if err != nil || lines < 0 {
+			return StartPosition{}, fmt.Errorf("Wrong amount of lines in start position: %s", s)
+		}
+		return StartPosition{kind: fromLastLines, lines: lines}, nil
+	default:
+		return StartPosition{}, fmt.Errorf("Unrecognized start position value: %s", s)
+	}
+}
+
+func (p StartPosition) String() string {
+	switch p.kind {
+	case fromBeginning:
+		return "beginning"
+	case fromLastLines:
+		return fmt.Sprintf("last:%d", p.lines)
+	default:
+		return "end"
+	}
+}
+
+// offset returns the offset in file matching the position
+func (p StartPosition) offset(file *os.File) (int64, error) {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	switch p.kind {
+	case fromBeginning:
+		return 0, nil
+	case fromLastLines:
+		return lastLinesOffset(file, fileInfo.Size(), p.lines)
+	default:
+		return fileInfo.Size(), nil
+	}
+}
+
+// lastLinesOffset finds the offset where the last n lines of the file start by
+// reading it backwards
+func lastLinesOffset(file *os.File, size int64, n int) (int64, error) {
+	if n == 0 {
+		return size, nil
+	}
+	buf := make([]byte, readBufferSize)
+	pos := size
+	// a trailing line break ends the last line, it does not start a new one
+	skipLast := true
+	for pos > 0 {
+		chunk := int64(len(buf))
+		if pos < chunk {
+			chunk = pos
+		}
+		pos -= chunk
+		if _, err := file.ReadAt(buf[:chunk], pos); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := chunk - 1; i >= 0; i-- {
+			if buf[i] != '\n' {
+				skipLast = false
+				continue
+			}
+			if skipLast {
+				skipLast = false
+				continue
+			}
+			n--
+			if n == 0 {
+				return pos + i + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,74 @@
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseStartPosition(t *testing.T) {
+	for _, s := range []string{"beginning", "end", "last:10"} {
+		position, err := ParseStartPosition(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if position.String() != s {
+			t.Errorf("Found: %s; wanted: %s", position, s)
+		}
+	}
+	for _, s := range []string{"", "middle", "last:", "last:-1", "last:a"} {
+		if _, err := ParseStartPosition(s); err == nil {
+			t.Errorf("Start position '%s' should be wrong", s)
+		}
+	}
+}
+
+func TestStartPositionOffset(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "position")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	defer tmpfile.Close()
+
+	content := "one\ntwo\nthree\n"
+	if _, err := tmpfile.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		position string
+		wanted   int64
+	}{
+		{"beginning", 0},
+		{"end", 14},
+		{"last:0", 14},
+		{"last:1", 8},
+		{"last:2", 4},
+		{"last:3", 0},
+		{"last:10", 0},
+	}
+	for _, test := range tests {
+		position, _ := ParseStartPosition(test.position)
+		offset, err := position.offset(tmpfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if offset != test.wanted {
+			t.Errorf("Found: %d; wanted: %d for %s", offset, test.wanted, test.position)
+		}
+	}
+
+	// an incomplete last line counts as a line
+	if _, err := tmpfile.Write([]byte("four")); err != nil {
+		t.Fatal(err)
+	}
+	position, _ := ParseStartPosition("last:2")
+	offset, err := position.offset(tmpfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset != 8 {
+		t.Errorf("Found: %d; wanted: %d", offset, 8)
+	}
+}
@@ -0,0 +1,57 @@
+package tail
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit bounds the amount of entries sent per second
+type RateLimit struct {
+	// Rate is the amount of entries per second allowed in the long run
+	Rate float64
+	// Burst is the amount of entries that can be sent at once. Zero means the
+	// amount allowed in a second
+	Burst int
+	// Sample tells that one in every Sample entries exceeding the limit is sent
+	// anyway. Zero or one means all of them are dropped
+	Sample int
+}
+
+// RateLimiter enforces a RateLimit with a token bucket. It is safe for
+// concurrent use, so a single one can be shared between files
+type RateLimiter struct {
+	mutex  sync.Mutex
+	limit  RateLimit
+	burst  float64
+	tokens float64
+	last   time.Time
+	// exceeded is the amount of entries exceeding the limit, for sampling them
+	exceeded int
+}
+
+// NewRateLimiter creates a RateLimiter whose bucket is full
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Max(limit.Rate, 1)
+	}
+	return &RateLimiter{limit: limit, burst: burst, tokens: burst}
+}
+
+// allow tells whether an entry can be sent at the given time
+func (r *RateLimiter) allow(now time.Time) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.last.IsZero() && now.After(r.last) {
+		r.tokens = math.Min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.limit.Rate)
+	}
+	r.last = now
+	if r.tokens >= 1 {
+		r.tokens--
+		return true
+	}
+	r.exceeded++
+	return r.limit.Sample > 1 && r.exceeded%r.limit.Sample == 0
+}
@@ -0,0 +1,77 @@
+package tail
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{Rate: 2})
+	now := time.Now()
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if limiter.allow(now) {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Errorf("Found: %d; wanted: %d allowed at once", allowed, 2)
+	}
+	if !limiter.allow(now.Add(500 * time.Millisecond)) {
+		t.Error("Entry should be allowed after refilling the bucket")
+	}
+	if limiter.allow(now.Add(500 * time.Millisecond)) {
+		t.Error("Entry should not be allowed with an empty bucket")
+	}
+}
+
+func TestRateLimiterSampling(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{Rate: 1, Burst: 1, Sample: 3})
+	now := time.Now()
+
+	allowed := []bool{}
+	for i := 0; i < 7; i++ {
+		allowed = append(allowed, limiter.allow(now))
+	}
+	wanted := []bool{true, false, false, true, false, false, true}
+	for i := range wanted {
+		if allowed[i] != wanted[i] {
+			t.Fatalf("Found: %v; wanted: %v", allowed, wanted)
+		}
+	}
+}
+
+func TestRateLimitReportsSuppressedLines(t *testing.T) {
+	chanOut := make(chan Entry)
+	global := NewRateLimiter(RateLimit{Rate: 0.001, Burst: 3})
+	config := Config{Accept: acceptF, RateLimit: &RateLimit{Rate: 0.001, Burst: 2}, GlobalRateLimiter: global, SuppressedReportInterval: 50 * time.Millisecond}
+	first, _ := lineProcessorWriter("first.log", chanOut, config)
+	second, _ := lineProcessorWriter("second.log", chanOut, config)
+	defer first.Close()
+	defer second.Close()
+
+	go func() {
+		first.Write([]byte("one\ntwo\nthree\nfour\n"))
+		second.Write([]byte("five\nsix\n"))
+	}()
+
+	wanted := []string{"one", "two", "five", "2 lines suppressed by rate limits in the last 50ms", "1 lines suppressed by rate limits in the last 50ms"}
+	found := map[string]Entry{}
+	for range wanted {
+		select {
+		case e := <-chanOut:
+			found[e.Message] = e
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for entries, found %v", found)
+		}
+	}
+	for _, message := range wanted {
+		if _, ok := found[message]; !ok {
+			t.Errorf("Entry '%s' not found in %v", message, found)
+		}
+	}
+	if report := found[wanted[3]]; report.Filename != "first.log" || report.Fields["suppressed"] != 2 || report.Level != "warn" {
+		t.Errorf("Found: %v; wanted a report for first.log", report)
+	}
+}
@@ -0,0 +1,204 @@
+package tail
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RedactMode is what is done with the sensitive data found in entries
+type RedactMode int
+
+const (
+	// RedactMask replaces sensitive data with a fixed mask
+	RedactMask RedactMode = iota
+	// RedactHash replaces sensitive data with a keyed hash of it, so equal
+	// values can still be correlated but not guessed without the key
+	RedactHash
+	// RedactDrop discards the entries holding sensitive data
+	RedactDrop
+)
+
+const redactedMask = "[REDACTED]"
+
+// ParseRedactMode returns the mode named s: Either 'mask', 'hash' or 'drop'
+func ParseRedactMode(s string) (RedactMode, error) {
+	switch s {
+	case "mask":
+		return RedactMask, nil
+	case "hash":
+		return RedactHash, nil
+	case "drop":
+		return RedactDrop, nil
+	}
+	return RedactMask, fmt.Errorf("Unrecognized redact mode: %s", s)
+}
+
+// RedactRule describes a kind of sensitive data
+type RedactRule struct {
+	// Name identifies the rule
+	Name string
+	// Pattern finds the sensitive data in texts. When it has groups, only the
+	// text matched by the first one is sensitive
+	Pattern *regexp.Regexp
+	// Valid tells whether a match is actually sensitive data. It is optional
+	Valid func(string) bool
+	// Fields finds the names of fields whose whole value is sensitive. It is optional
+	Fields *regexp.Regexp
+}
+
+// redactDetectors are the built-in rules
+var redactDetectors = map[string]RedactRule{
+	"email": {
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	},
+	"card": {
+		Pattern: regexp.MustCompile(`\b[2-6]\d(?:[ -]?\d){11,17}\b`),
+		Valid:   luhnValid,
+	},
+	"token": {
+		Pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]+=*)|\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+	},
+	"aws_key": {
+		Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	},
+	"secret": {
+		Pattern: regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|token|api_?key|access_?key)\s*[=:]\s*("[^"]*"|[^\s,;&]+)`),
+		Fields:  regexp.MustCompile(`(?i)^(?:password|passwd|pwd|secret|token|api_?key|access_?key)$`),
+	},
+}
+
+// RedactDetectorNames returns the names of the built-in rules
+func RedactDetectorNames() []string {
+	return []string{"email", "card", "token", "aws_key", "secret"}
+}
+
+// RedactDetector returns the built-in rule named name
+func RedactDetector(name string) (RedactRule, error) {
+	rule, ok := redactDetectors[name]
+	if !ok {
+		return RedactRule{}, fmt.Errorf("Unrecognized redact detector: %s", name)
+	}
+	rule.Name = name
+	return rule, nil
+}
+
+// luhnValid tells whether the digits in s pass the Luhn checksum used by card numbers
+func luhnValid(s string) bool {
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		digit := int(s[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// Redactor removes sensitive data out of entries
+type Redactor struct {
+	Rules []RedactRule
+	Mode  RedactMode
+	// HashKey is the secret key of the hashes in RedactHash mode
+	HashKey []byte
+}
+
+// NewRedactor returns a Redactor applying rules in the given mode. hashKey is
+// only used in RedactHash mode, where it is required
+func NewRedactor(rules []RedactRule, mode RedactMode, hashKey []byte) (*Redactor, error) {
+	if mode == RedactHash && len(hashKey) == 0 {
+		return nil, errors.New("A key is required for hashing sensitive data")
+	}
+	return &Redactor{Rules: rules, Mode: mode, HashKey: hashKey}, nil
+}
+
+// redact replaces the sensitive data found in the message and the fields of
+// the entry. It returns false if the entry must be dropped instead
+func (r *Redactor) redact(e *Entry) bool {
+	found := false
+	e.Message = r.redactText(e.Message, &found)
+	if len(e.Fields) > 0 {
+		fields := make(map[string]interface{}, len(e.Fields))
+		for key, value := range e.Fields {
+			fields[key] = r.redactField(key, value, &found)
+		}
+		e.Fields = fields
+	}
+	return !(found && r.Mode == RedactDrop)
+}
+
+func (r *Redactor) redactField(key string, value interface{}, found *bool) interface{} {
+	for _, rule := range r.Rules {
+		if rule.Fields != nil && rule.Fields.MatchString(key) {
+			*found = true
+			return r.replacement(fieldToString(value))
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return r.redactText(v, found)
+	case map[string]interface{}:
+		fields := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			fields[key] = r.redactField(key, value, found)
+		}
+		return fields
+	case []interface{}:
+		values := make([]interface{}, len(v))
+		for i, value := range v {
+			values[i] = r.redactField("", value, found)
+		}
+		return values
+	}
+	return value
+}
+
+// redactText replaces the sensitive data found in s. found is set when there is any
+func (r *Redactor) redactText(s string, found *bool) string {
+	for _, rule := range r.Rules {
+		matches := rule.Pattern.FindAllStringSubmatchIndex(s, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, match := range matches {
+			start, end := match[0], match[1]
+			if len(match) > 2 && match[2] >= 0 {
+				start, end = match[2], match[3]
+			}
+			if rule.Valid != nil && !rule.Valid(s[start:end]) {
+				continue
+			}
+			*found = true
+			b.WriteString(s[last:start])
+			b.WriteString(r.replacement(s[start:end]))
+			last = end
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
+
+func (r *Redactor) replacement(s string) string {
+	if r.Mode == RedactHash {
+		mac := hmac.New(sha256.New, r.HashKey)
+		mac.Write([]byte(s))
+		return "[hmac:" + hex.EncodeToString(mac.Sum(nil)[:6]) + "]"
+	}
+	return redactedMask
+}
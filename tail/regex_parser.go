@@ -0,0 +1,113 @@
+package tail
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// grokPatterns are the built-in patterns that can be referenced from regex
+// parser patterns as %{NAME} or %{NAME:field}, the latter capturing the match
+// as a field
+var grokPatterns = map[string]string{
+	"WORD":              `\b\w+\b`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"INT":               `[+-]?\d+`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d*)?|\.\d+)`,
+	"IPV4":              `(?:\d{1,3}\.){3}\d{1,3}`,
+	"IPV6":              `[0-9A-Fa-f:]*:[0-9A-Fa-f:.]+`,
+	"IP":                `(?:%{IPV6}|%{IPV4})`,
+	"HOSTNAME":          `\b[0-9A-Za-z][0-9A-Za-z\-_.]*\b`,
+	"IPORHOST":          `(?:%{IP}|%{HOSTNAME})`,
+	"USER":              `[a-zA-Z0-9._-]+`,
+	"PROG":              `[^\s\[\]:]+`,
+	"QS":                `"(?:[^"\\]|\\.)*"`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|err(?:or)?|crit(?:ical)?|alert|fatal|emerg(?:ency)?|panic)`,
+	"HTTPDATE":          `\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:[.,]\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"SYSLOGTIMESTAMP":   `\w{3} +\d{1,2} \d{2}:\d{2}:\d{2}`,
+	"COMMONAPACHELOG":   `%{IPORHOST:client} %{USER:ident} %{USER:auth} \[%{HTTPDATE:timestamp}\] "(?:%{WORD:method} %{NOTSPACE:request}(?: HTTP/%{NUMBER:http_version})?|%{DATA:raw_request})" %{INT:status} (?:%{INT:bytes}|-)`,
+	"COMBINEDAPACHELOG": `%{COMMONAPACHELOG} "%{DATA:referrer}" "%{DATA:agent}"`,
+	"SYSLOGLINE":        `%{SYSLOGTIMESTAMP:timestamp} %{IPORHOST:hostname} %{PROG:program}(?:\[%{INT:pid}\])?: %{GREEDYDATA:msg}`,
+	"LEVELLINE":         `\[%{LOGLEVEL:level}\] %{TIMESTAMP_ISO8601:timestamp} %{GREEDYDATA:msg}`,
+}
+
+var grokReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?\}`)
+
+// maxGrokDepth avoids expanding patterns that reference themselves forever
+const maxGrokDepth = 16
+
+// expandGrok replaces the references to built-in patterns in pattern
+func expandGrok(pattern string) (string, error) {
+	for depth := 0; grokReference.MatchString(pattern); depth++ {
+		if depth == maxGrokDepth {
+			return "", errors.New("Too many nested pattern references")
+		}
+		var err error
+		pattern = grokReference.ReplaceAllStringFunc(pattern, func(reference string) string {
+			groups := grokReference.FindStringSubmatch(reference)
+			expansion, ok := grokPatterns[groups[1]]
+			if !ok {
+				err = fmt.Errorf("Unknown pattern reference: %s", reference)
+				return reference
+			}
+			if groups[2] != "" {
+				return fmt.Sprintf("(?P<%s>%s)", groups[2], expansion)
+			}
+			return fmt.Sprintf("(?:%s)", expansion)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return pattern, nil
+}
+
+// RegexParser extracts the named groups of pattern as fields. pattern may
+// reference built-in patterns, e.g. %{COMBINEDAPACHELOG}. When a group is
+// named messageKey, its match becomes the message of the entry
+func RegexParser(pattern string, messageKey string) (Parser, error) {
+	expanded, err := expandGrok(pattern)
+	if err != nil {
+		return nil, err
+	}
+	regex, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, err
+	}
+	names := regex.SubexpNames()
+	hasNames := false
+	for _, name := range names {
+		hasNames = hasNames || name != ""
+	}
+	if !hasNames {
+		return nil, fmt.Errorf("Pattern '%s' has no named groups", pattern)
+	}
+
+	return func(e *Entry) error {
+		matches := regex.FindStringSubmatchIndex(e.Message)
+		if matches == nil {
+			return errors.New("Message does not match the pattern")
+		}
+		fields := map[string]interface{}{}
+		message := e.Message
+		for i, name := range names {
+			start, end := matches[2*i], matches[2*i+1]
+			if name == "" || start < 0 {
+				continue
+			}
+			value := e.Message[start:end]
+			if name == messageKey {
+				message = value
+				continue
+			}
+			fields[name] = value
+		}
+		e.Message = message
+		e.addFields(fields)
+		return nil
+	}, nil
+}
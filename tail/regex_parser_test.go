@@ -0,0 +1,79 @@
+package tail
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegexParser(t *testing.T) {
+	parser, err := RegexParser(`^(?P<level>\w+): (?P<msg>.*)$`, "msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := Entry{Message: "WARN: disk almost full"}
+	if err := parser(&e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Message != "disk almost full" || e.Fields["level"] != "WARN" {
+		t.Errorf("Found: %s %v", e.Message, e.Fields)
+	}
+
+	e = Entry{Message: "no level here"}
+	if err := parser(&e); err == nil {
+		t.Error("Parsing a non matching message should fail")
+	}
+}
+
+func TestRegexParserCombinedPreset(t *testing.T) {
+	parser, err := RegexParser("%{COMBINEDAPACHELOG}", "msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08"`
+	e := Entry{Message: line}
+	if err := parser(&e); err != nil {
+		t.Fatal(err)
+	}
+	wanted := map[string]interface{}{
+		"client":       "127.0.0.1",
+		"ident":        "-",
+		"auth":         "frank",
+		"timestamp":    "10/Oct/2000:13:55:36 -0700",
+		"method":       "GET",
+		"request":      "/apache_pb.gif",
+		"http_version": "1.0",
+		"status":       "200",
+		"bytes":        "2326",
+		"referrer":     "http://www.example.com/start.html",
+		"agent":        "Mozilla/4.08",
+	}
+	if !reflect.DeepEqual(e.Fields, wanted) {
+		t.Errorf("Found: %v; wanted: %v", e.Fields, wanted)
+	}
+	if e.Message != line {
+		t.Errorf("Found: %s; wanted: %s", e.Message, line)
+	}
+}
+
+func TestRegexParserSyslogPreset(t *testing.T) {
+	parser, err := RegexParser("%{SYSLOGLINE}", "msg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := Entry{Message: "Oct  5 13:55:36 myhost sshd[1234]: Accepted publickey"}
+	if err := parser(&e); err != nil {
+		t.Fatal(err)
+	}
+	wanted := map[string]interface{}{"timestamp": "Oct  5 13:55:36", "hostname": "myhost", "program": "sshd", "pid": "1234"}
+	if !reflect.DeepEqual(e.Fields, wanted) || e.Message != "Accepted publickey" {
+		t.Errorf("Found: %s %v; wanted: %v", e.Message, e.Fields, wanted)
+	}
+}
+
+func TestRegexParserWrongPatterns(t *testing.T) {
+	for _, pattern := range []string{"no groups", "%{UNKNOWN:field}", "(?P<broken"} {
+		if _, err := RegexParser(pattern, "msg"); err == nil {
+			t.Errorf("Pattern '%s' should be wrong", pattern)
+		}
+	}
+}
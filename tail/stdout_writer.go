@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"text/template"
 
 	"github.com/oscar-martin/tail_folders/logger"
 )
@@ -14,10 +18,14 @@ import (
 type entryToStringF func(e Entry, tag string) (string, error)
 
 func EntryToRawString(e Entry, tag string) (string, error) {
+	message := e.Message
+	if len(e.Fields) > 0 {
+		message = strings.TrimLeft(message+" "+fieldsToString(e.Fields), " ")
+	}
 	if tag == "" {
-		return fmt.Sprintf("[%s] %s", e.File, e.Message), nil
+		return fmt.Sprintf("[%s] %s", e.File, message), nil
 	}
-	return fmt.Sprintf("[%s] [%s] %s", tag, e.File, e.Message), nil
+	return fmt.Sprintf("[%s] [%s] %s", tag, e.File, message), nil
 }
 
 func EntryToJsonString(e Entry, tag string) (string, error) {
@@ -29,6 +37,79 @@ func EntryToJsonString(e Entry, tag string) (string, error) {
 	return string(bytes), nil
 }
 
+// EntryToTemplateString returns a function formatting entries with the raw
+// output template. The template is executed on the entry, e.g.
+// '{{.Labels.env}} [{{.File}}] {{.Message}}', and can use the 'fields'
+// function for getting the fields as key=value pairs
+func EntryToTemplateString(text string) (entryToStringF, error) {
+	tmpl, err := template.New("raw").
+		Option("missingkey=zero").
+		Funcs(template.FuncMap{"fields": fieldsToString}).
+		Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(e Entry, tag string) (string, error) {
+		e.Tag = tag
+		var b strings.Builder
+		if err := tmpl.Execute(&b, e); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}, nil
+}
+
+// EntryToMergedJsonString is like EntryToJsonString but fields are set at top
+// level. Fields whose name clash with the ones of the entry are kept nested
+func EntryToMergedJsonString(e Entry, tag string) (string, error) {
+	fields := e.Fields
+	e.Fields = nil
+	e.Tag = tag
+	entryBytes, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	merged := map[string]interface{}{}
+	if err := json.Unmarshal(entryBytes, &merged); err != nil {
+		return "", err
+	}
+	clashing := map[string]interface{}{}
+	for key, value := range fields {
+		if _, ok := merged[key]; ok {
+			clashing[key] = value
+		} else {
+			merged[key] = value
+		}
+	}
+	if len(clashing) > 0 {
+		merged["fields"] = clashing
+	}
+	bytes, err := json.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// fieldsToString formats the fields as key=value pairs sorted by key
+func fieldsToString(fields map[string]interface{}) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := fieldToString(fields[key])
+		if value == "" || strings.ContainsAny(value, " \"=") {
+			value = strconv.Quote(value)
+		}
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, " ")
+}
+
 type OutWriter struct {
 	mux      *sync.Mutex
 	w        io.Writer
@@ -74,3 +155,15 @@ func (ow *OutWriter) String() string {
 	defer ow.mux.Unlock()
 	return fmt.Sprintf("%s", ow.w)
 }
+
+// fieldToString formats a field value. Values other than strings are formatted as json
+func fieldToString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(valueBytes)
+}
@@ -31,3 +31,49 @@ func TestStdoutWriterWithTag(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestEntryToStringWithFields(t *testing.T) {
+	e := Entry{File: "file.txt", Filename: "file.txt", Message: "started", Fields: map[string]interface{}{"level": "info", "file": "main.go", "took": "1 s"}}
+
+	raw, _ := EntryToRawString(e, "")
+	wanted := `[file.txt] started file=main.go level=info took="1 s"`
+	if raw != wanted {
+		t.Errorf("Found: %s; wanted: %s", raw, wanted)
+	}
+
+	nested, _ := EntryToJsonString(e, "")
+	wanted = `{"file":"file.txt","msg":"started","time":"0001-01-01T00:00:00Z","fields":{"file":"main.go","level":"info","took":"1 s"}}`
+	if nested != wanted {
+		t.Errorf("Found: %s; wanted: %s", nested, wanted)
+	}
+
+	merged, _ := EntryToMergedJsonString(e, "aTag")
+	wanted = `{"fields":{"file":"main.go"},"file":"file.txt","level":"info","msg":"started","tag":"aTag","time":"0001-01-01T00:00:00Z","took":"1 s"}`
+	if merged != wanted {
+		t.Errorf("Found: %s; wanted: %s", merged, wanted)
+	}
+}
+
+func TestEntryToTemplateString(t *testing.T) {
+	e := Entry{File: "file.txt", Filename: "file.txt", Message: "started", Level: "info", Fields: map[string]interface{}{"port": 8080}, Labels: map[string]string{"env": "prod"}}
+
+	toString, err := EntryToTemplateString(`{{.Tag}} {{.Labels.env}}/{{.Labels.region}} [{{.File}}] {{.Level}}: {{.Message}} {{fields .Fields}}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	raw, _ := toString(e, "aTag")
+	wanted := `aTag prod/ [file.txt] info: started port=8080`
+	if raw != wanted {
+		t.Errorf("Found: %s; wanted: %s", raw, wanted)
+	}
+
+	json, _ := EntryToJsonString(e, "")
+	wanted = `{"file":"file.txt","msg":"started","time":"0001-01-01T00:00:00Z","level":"info","fields":{"port":8080},"labels":{"env":"prod"}}`
+	if json != wanted {
+		t.Errorf("Found: %s; wanted: %s", json, wanted)
+	}
+
+	if _, err := EntryToTemplateString(`{{.Message`); err == nil {
+		t.Error("Template should be wrong")
+	}
+}
@@ -0,0 +1,155 @@
+package tail
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// syslogPriority matches the optional priority at the start of syslog lines
+var syslogPriority = regexp.MustCompile(`^<(\d{1,3})>`)
+
+// rfc3164Line matches traditional syslog lines after the priority. The timestamp
+// can be written either the traditional way or as in RFC 3339, as rsyslog does
+var rfc3164Line = regexp.MustCompile(`^(?P<timestamp>[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\S+) (?:(?P<hostname>\S+) )?(?P<appname>[^\s\[\]:]+)(?:\[(?P<procid>[^\]]*)\])?: ?(?P<msg>.*)$`)
+
+// SyslogParser decodes messages written in syslog formats, either RFC 5424 or
+// the traditional RFC 3164 one, into the fields facility, severity, timestamp,
+// hostname, appname, procid, msgid and structured_data. Fields missing in the
+// message are not set. The free-form part becomes the message of the entry
+func SyslogParser() Parser {
+	return func(e *Entry) error {
+		rest := strings.TrimSpace(e.Message)
+		fields := map[string]interface{}{}
+		if match := syslogPriority.FindStringSubmatch(rest); match != nil {
+			priority, _ := strconv.Atoi(match[1])
+			if priority/8 >= len(syslogFacilities) {
+				return errors.New("Syslog priority is out of range")
+			}
+			fields["facility"] = syslogFacilities[priority/8]
+			fields["severity"] = syslogSeverities[priority%8]
+			rest = rest[len(match[0]):]
+		}
+
+		var message string
+		var err error
+		if strings.HasPrefix(rest, "1 ") {
+			message, err = parseRFC5424(rest[2:], fields)
+		} else {
+			message, err = parseRFC3164(rest, fields)
+		}
+		if err != nil {
+			return err
+		}
+		e.Message = message
+		e.addFields(fields)
+		return nil
+	}
+}
+
+func parseRFC3164(s string, fields map[string]interface{}) (string, error) {
+	match := rfc3164Line.FindStringSubmatchIndex(s)
+	if match == nil {
+		return "", errors.New("Message is not a syslog line")
+	}
+	message := ""
+	for i, name := range rfc3164Line.SubexpNames() {
+		start, end := match[2*i], match[2*i+1]
+		if name == "" || start < 0 || start == end {
+			continue
+		}
+		if name == "msg" {
+			message = s[start:end]
+			continue
+		}
+		fields[name] = s[start:end]
+	}
+	return message, nil
+}
+
+// parseRFC5424 parses the line after its priority and version
+func parseRFC5424(s string, fields map[string]interface{}) (string, error) {
+	header := strings.SplitN(s, " ", 6)
+	if len(header) < 6 {
+		return "", errors.New("Message is not a RFC 5424 syslog line")
+	}
+	for i, name := range []string{"timestamp", "hostname", "appname", "procid", "msgid"} {
+		// nil values are written as a dash
+		if header[i] != "-" {
+			fields[name] = header[i]
+		}
+	}
+
+	rest := header[5]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		data, n, err := parseStructuredData(rest)
+		if err != nil {
+			return "", err
+		}
+		fields["structured_data"] = data
+		rest = rest[n:]
+	}
+	if rest != "" && rest[0] != ' ' {
+		return "", errors.New("Wrong structured data in syslog line")
+	}
+	message := strings.TrimPrefix(rest, " ")
+	// the message may start with a byte order mark when it is UTF-8
+	return strings.TrimPrefix(message, "\ufeff"), nil
+}
+
+// parseStructuredData parses the structured data elements at the start of s,
+// such as [id key="value"][id2 key="value"]. It returns them as a map of
+// parameters per element id along with the amount of bytes parsed
+func parseStructuredData(s string) (map[string]interface{}, int, error) {
+	data := map[string]interface{}{}
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		end := i + 1
+		for end < len(s) && s[end] != ' ' && s[end] != ']' {
+			end++
+		}
+		id := s[i+1 : end]
+		params := map[string]interface{}{}
+		i = end
+		for i < len(s) && s[i] == ' ' {
+			i++
+			eq := strings.IndexByte(s[i:], '=')
+			if eq <= 0 || i+eq+1 >= len(s) || s[i+eq+1] != '"' {
+				return nil, 0, errors.New("Wrong structured data parameter in syslog line")
+			}
+			name := s[i : i+eq]
+			i += eq + 2
+			var value strings.Builder
+			for i < len(s) && s[i] != '"' {
+				// quotes, backslashes and closing brackets are escaped with a backslash
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+					i++
+				}
+				value.WriteByte(s[i])
+				i++
+			}
+			if i >= len(s) {
+				return nil, 0, errors.New("Unterminated structured data parameter in syslog line")
+			}
+			params[name] = value.String()
+			i++
+		}
+		if i >= len(s) || s[i] != ']' || id == "" {
+			return nil, 0, errors.New("Wrong structured data element in syslog line")
+		}
+		data[id] = params
+		i++
+	}
+	return data, i, nil
+}
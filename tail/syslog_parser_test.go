@@ -0,0 +1,83 @@
+package tail
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSyslogParser(t *testing.T) {
+	tests := []struct {
+		line    string
+		message string
+		fields  map[string]interface{}
+	}{
+		{
+			`<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - 'su root' failed for lonvick on /dev/pts/8`,
+			"'su root' failed for lonvick on /dev/pts/8",
+			map[string]interface{}{"facility": "auth", "severity": "crit", "timestamp": "2003-10-11T22:14:15.003Z", "hostname": "mymachine.example.com", "appname": "su", "msgid": "ID47"},
+		},
+		{
+			`<165>1 2003-10-11T22:14:15.003Z host evntslog 1234 - [exampleSDID@32473 iut="3" eventID="10\]11"][origin ip="10.0.0.1"] ` + "\ufeff" + `An application event`,
+			"An application event",
+			map[string]interface{}{"facility": "local4", "severity": "notice", "timestamp": "2003-10-11T22:14:15.003Z", "hostname": "host", "appname": "evntslog", "procid": "1234",
+				"structured_data": map[string]interface{}{"exampleSDID@32473": map[string]interface{}{"iut": "3", "eventID": "10]11"}, "origin": map[string]interface{}{"ip": "10.0.0.1"}}},
+		},
+		{
+			`<13>1 - - - - - -`,
+			"",
+			map[string]interface{}{"facility": "user", "severity": "notice"},
+		},
+		{
+			`<38>Oct  5 13:55:36 myhost sshd[1234]: Accepted publickey for bob`,
+			"Accepted publickey for bob",
+			map[string]interface{}{"facility": "auth", "severity": "info", "timestamp": "Oct  5 13:55:36", "hostname": "myhost", "appname": "sshd", "procid": "1234"},
+		},
+		{
+			`2019-05-05T20:26:59.596488+02:00 myhost kernel: eth0: link up`,
+			"eth0: link up",
+			map[string]interface{}{"timestamp": "2019-05-05T20:26:59.596488+02:00", "hostname": "myhost", "appname": "kernel"},
+		},
+		{
+			`Oct 15 08:00:01 CRON[42]: job started`,
+			"job started",
+			map[string]interface{}{"timestamp": "Oct 15 08:00:01", "appname": "CRON", "procid": "42"},
+		},
+	}
+	for _, test := range tests {
+		e := Entry{Message: test.line}
+		if err := SyslogParser()(&e); err != nil {
+			t.Errorf("Unexpected error parsing %s: %v", test.line, err)
+			continue
+		}
+		if e.Message != test.message {
+			t.Errorf("Found: %s; wanted: %s", e.Message, test.message)
+		}
+		if !reflect.DeepEqual(e.Fields, test.fields) {
+			t.Errorf("Found: %v; wanted: %v", e.Fields, test.fields)
+		}
+	}
+}
+
+func TestSyslogParserFailures(t *testing.T) {
+	lines := []string{
+		"just some text",
+		"<999>Oct  5 13:55:36 myhost sshd[1234]: message",
+		"<34>1 2003-10-11T22:14:15.003Z host",
+		`<34>1 2003-10-11T22:14:15.003Z host app - - [id key="unterminated] message`,
+		`<34>1 2003-10-11T22:14:15.003Z host app - - [id key=value] message`,
+	}
+	for _, line := range lines {
+		e := Entry{Message: line}
+		if err := SyslogParser()(&e); err == nil {
+			t.Errorf("Parsing '%s' should fail, found %v", line, e.Fields)
+		}
+	}
+}
+
+func TestSyslogSeverityIsLevel(t *testing.T) {
+	e := Entry{Message: "<11>Oct  5 13:55:36 myhost app: disk failure"}
+	SyslogParser()(&e)
+	if level := detectLevel(e); level != LevelError {
+		t.Errorf("Found: %v; wanted: %v", level, LevelError)
+	}
+}
@@ -1,19 +1,83 @@
 package tail
 
 import (
-	"bufio"
+	"bytes"
+	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/oscar-martin/tail_folders/checkpoint"
 	"github.com/oscar-martin/tail_folders/logger"
 )
 
 type acceptFunc func(string) bool
 
+// Config gathers the settings for following files and processing their lines
+type Config struct {
+	// Accept tells whether a line must be sent
+	Accept acceptFunc
+	// Registry keeps the offsets read so far. It is optional
+	Registry *checkpoint.Registry
+	// AcceptRotation tells whether the follower of filename switches to the new
+	// file found at its path on rotation, whose info is given, or it stops
+	// instead, e.g. because the new file is already followed through another
+	// path. It is optional
+	AcceptRotation func(filename string, info os.FileInfo) bool
+	// InitialStart is where to start following files found at startup
+	InitialStart StartPosition
+	// CreatedStart is where to start following files created after startup
+	CreatedStart StartPosition
+	// Multiline joins related lines before accepting them. It is optional
+	Multiline *Multiline
+	// MaxLineSize is the maximum size in bytes of a line. Zero means no limit
+	MaxLineSize int
+	// SplitLongLines tells whether lines longer than MaxLineSize are split in
+	// several lines instead of being truncated
+	SplitLongLines bool
+	// Parser extracts fields out of messages before accepting them. It is optional
+	Parser Parser
+	// FilterField is the parsed field Accept is applied on. The message is used when empty
+	FilterField string
+	// Timestamp gets the time of entries out of their content. It is optional
+	Timestamp *Timestamp
+	// MinLevel discards entries whose level is known and lower than it
+	MinLevel Level
+	// EntryFilter tells whether an entry must be sent once it has been accepted.
+	// It is optional
+	EntryFilter func(Entry) bool
+	// Redactor removes sensitive data out of entries before sending them. It is optional
+	Redactor *Redactor
+	// Labels are attached to every entry. They must not be modified afterwards
+	Labels map[string]string
+	// PathPattern is matched against the absolute path of files and its named
+	// groups become fields of their entries. It is optional
+	PathPattern *regexp.Regexp
+	// ContainerFormat is the container runtime format lines are unwrapped from
+	// before any other processing
+	ContainerFormat ContainerFormat
+	// RateLimit bounds the amount of entries sent per file. It is optional
+	RateLimit *RateLimit
+	// GlobalRateLimiter bounds the amount of entries sent by all the files
+	// sharing it. It is optional
+	GlobalRateLimiter *RateLimiter
+	// SuppressedReportInterval is the time between the entries reporting how
+	// many lines of a file have been suppressed by rate limits. Zero means no
+	// reports are sent
+	SuppressedReportInterval time.Duration
+	// CollapseTimeout enables collapsing consecutive entries of a file with the
+	// same message into an entry telling how many times it has been repeated,
+	// which is sent when a different message arrives or once this time elapses.
+	// Zero means entries are not collapsed
+	CollapseTimeout time.Duration
+}
+
 // Entry models a line read from a source file
 type Entry struct {
 	// Tag is user-provided setting for different tail_folders processes running
@@ -29,16 +93,98 @@ type Entry struct {
 	File string `json:"-"`
 	// Message is the actual payload read from the source file
 	Message string `json:"msg,omitempty"`
-	// Timestamp is the time where the log is read
+	// Timestamp is the time found in the log, or the time where the log is read
+	// when there is none
 	Timestamp time.Time `json:"time,omitempty"`
+	// ReadTime is the time where the log is read. It is set only when the
+	// Timestamp is found in the log
+	ReadTime *time.Time `json:"read_time,omitempty"`
+	// Truncated tells whether the message has been truncated because it was too long
+	Truncated bool `json:"truncated,omitempty"`
+	// Level is the severity detected in the log, if any
+	Level string `json:"level,omitempty"`
+	// Fields are the structured data parsed from the message
+	Fields map[string]interface{} `json:"fields,omitempty"`
+	// Labels are the user-provided key/value pairs attached to every entry
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// addFields sets the fields into the entry, replacing existing ones with the same name
+func (e *Entry) addFields(fields map[string]interface{}) {
+	if len(fields) == 0 {
+		return
+	}
+	if e.Fields == nil {
+		e.Fields = make(map[string]interface{}, len(fields))
+	}
+	for key, value := range fields {
+		e.Fields[key] = value
+	}
+}
+
+// FieldValue returns the value of the field as a string, or false if the entry
+// has no such field
+func (e Entry) FieldValue(name string) (string, bool) {
+	value, ok := e.Fields[name]
+	if !ok {
+		return "", false
+	}
+	return fieldToString(value), true
 }
 
-func lineProcessorWriter(fpath string, toEntryChan chan<- Entry, acceptF acceptFunc) (io.Writer, error) {
-	pipeReader, pipeWriter := io.Pipe()
+// line is a piece of text read from a source file
+type line struct {
+	text      string
+	truncated bool
+	// stream and time are set when the line is unwrapped out of a container
+	// runtime format
+	stream string
+	time   time.Time
+}
 
-	scanner := bufio.NewScanner(pipeReader)
-	scanner.Split(bufio.ScanLines)
+// lineProcessor splits the bytes written into it in lines and sends an Entry
+// for each accepted line, or for each group of lines in multiline mode
+type lineProcessor struct {
+	mutex       sync.Mutex
+	hostname    string
+	folders     []string
+	file        string
+	fpath       string
+	pending     []byte
+	maxLineSize int
+	splitLong   bool
+	// discarding is set after truncating a line till its end is found
+	discarding        bool
+	toEntryChan       chan<- Entry
+	acceptF           acceptFunc
+	parser            Parser
+	timestamp         *Timestamp
+	filterField       string
+	minLevel          Level
+	entryFilter       func(Entry) bool
+	redactor          *Redactor
+	labels            map[string]string
+	pathFields        map[string]interface{}
+	decoder           *containerDecoder
+	rateLimiter       *RateLimiter
+	globalRateLimiter *RateLimiter
+	// suppressed is the amount of entries dropped by rate limits since the last report
+	suppressed      int
+	reportInterval  time.Duration
+	reportTimer     *time.Timer
+	collapseTimeout time.Duration
+	// last is the last entry sent, when collapsing repeated entries
+	last *Entry
+	// repeated is the amount of times the last entry has been repeated since it was reported
+	repeated      int
+	collapseTimer *time.Timer
+	multiline     *multilineAggregator
+	flushTimer    *time.Timer
+	done          chan struct{}
+	closeOnce     sync.Once
+}
 
+func lineProcessorWriter(fpath string, toEntryChan chan<- Entry, config Config) (*lineProcessor, error) {
 	hostname, err := os.Hostname()
 	if err != nil {
 		return nil, err
@@ -54,48 +200,467 @@ func lineProcessorWriter(fpath string, toEntryChan chan<- Entry, acceptF acceptF
 		}
 	}
 
-	go func(host string, folders []string, file string) {
-		for scanner.Scan() {
-			message := string(scanner.Bytes())
-			if acceptF(message) {
-				now := time.Now()
-				entry := Entry{
-					Folders:   folders,
-					Message:   message,
-					Timestamp: now,
-					File:      fpath,
-					Filename:  file,
-					Hostname:  hostname,
-				}
-				toEntryChan <- entry
+	lp := &lineProcessor{
+		hostname:          hostname,
+		folders:           folders,
+		file:              file,
+		fpath:             fpath,
+		maxLineSize:       config.MaxLineSize,
+		splitLong:         config.SplitLongLines,
+		toEntryChan:       toEntryChan,
+		acceptF:           config.Accept,
+		parser:            config.Parser,
+		timestamp:         config.Timestamp,
+		filterField:       config.FilterField,
+		minLevel:          config.MinLevel,
+		entryFilter:       config.EntryFilter,
+		redactor:          config.Redactor,
+		labels:            config.Labels,
+		globalRateLimiter: config.GlobalRateLimiter,
+		reportInterval:    config.SuppressedReportInterval,
+		collapseTimeout:   config.CollapseTimeout,
+		pathFields:        pathFields(fpath, config.PathPattern),
+		done:              make(chan struct{}),
+	}
+	if config.Multiline != nil {
+		lp.multiline = &multilineAggregator{config: config.Multiline}
+	}
+	if config.ContainerFormat != ContainerFormatNone {
+		lp.decoder = &containerDecoder{format: config.ContainerFormat, maxLineSize: config.MaxLineSize, splitLong: config.SplitLongLines}
+		if lp.maxLineSize > 0 && lp.maxLineSize < maxContainerRecordSize {
+			// records must not be cut before being unwrapped
+			lp.maxLineSize = maxContainerRecordSize
+		}
+	}
+	if config.RateLimit != nil {
+		lp.rateLimiter = NewRateLimiter(*config.RateLimit)
+	}
+	return lp, nil
+}
+
+// pathFields returns the named groups of the pattern found in the absolute
+// path of the file, or nil if there is none
+func pathFields(fpath string, pattern *regexp.Regexp) map[string]interface{} {
+	if pattern == nil {
+		return nil
+	}
+	absPath, err := filepath.Abs(fpath)
+	if err != nil {
+		absPath = fpath
+	}
+	absPath = filepath.ToSlash(absPath)
+	match := pattern.FindStringSubmatchIndex(absPath)
+	if match == nil {
+		return nil
+	}
+	fields := map[string]interface{}{}
+	for i, name := range pattern.SubexpNames() {
+		// groups in alternatives not taken are skipped, so they can share names
+		if name != "" && match[2*i] >= 0 {
+			fields[name] = absPath[match[2*i]:match[2*i+1]]
+		}
+	}
+	return fields
+}
+
+// Write processes every complete line found in p. Incomplete lines are kept
+// until the rest of the line is written, unless they are longer than the
+// maximum line size
+func (lp *lineProcessor) Write(p []byte) (int, error) {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
+	lp.pending = append(lp.pending, p...)
+	for {
+		idx := bytes.IndexByte(lp.pending, '\n')
+		if lp.discarding {
+			// skip the rest of a truncated line
+			if idx < 0 {
+				lp.pending = nil
+				break
 			}
+			lp.pending = lp.pending[idx+1:]
+			lp.discarding = false
+			continue
+		}
+		if lp.isTooLong(idx) {
+			if !lp.processLongLine() {
+				return len(p), io.ErrClosedPipe
+			}
+			continue
+		}
+		if idx < 0 {
+			break
+		}
+		text := bytes.TrimSuffix(lp.pending[:idx], []byte{'\r'})
+		l := line{text: string(text)}
+		lp.pending = lp.pending[idx+1:]
+		if !lp.processLine(l, idx+1) {
+			return len(p), io.ErrClosedPipe
 		}
-	}(hostname, folders, file)
+	}
+	// do not keep a reference to an already consumed backing array
+	if len(lp.pending) == 0 {
+		lp.pending = nil
+	}
+	lp.scheduleMultilineFlush()
+	return len(p), nil
+}
 
-	return pipeWriter, nil
+// isTooLong tells whether the pending line exceeds the maximum line size.
+// idx is the position of the line break in the pending bytes, if any
+func (lp *lineProcessor) isTooLong(idx int) bool {
+	if lp.maxLineSize <= 0 {
+		return false
+	}
+	if idx < 0 {
+		return len(lp.pending) > lp.maxLineSize
+	}
+	return idx > lp.maxLineSize
 }
 
-func DoTail(filename string, toEntryChan chan<- Entry, acceptF acceptFunc) (*os.Process, error) {
-	prefixWriter, err := lineProcessorWriter(filename, toEntryChan, acceptF)
-	if err != nil {
-		return nil, err
+// processLongLine takes the first maximum line size bytes of the pending line
+// as a line. The rest of it is either kept as a new line or discarded
+func (lp *lineProcessor) processLongLine() bool {
+	cut := runeCut(lp.pending, lp.maxLineSize)
+	l := line{text: string(lp.pending[:cut]), truncated: !lp.splitLong}
+	lp.pending = lp.pending[cut:]
+	lp.discarding = !lp.splitLong
+	return lp.processLine(l, cut)
+}
+
+// runeCut returns where to cut b, which is longer than max bytes, so the first
+// part is at most max bytes long without breaking a multi-byte character
+func runeCut(b []byte, max int) int {
+	cut := max
+	for i := 0; i < utf8.UTFMax && cut-i > 0; i++ {
+		if utf8.RuneStart(b[cut-i]) {
+			return cut - i
+		}
+	}
+	return cut
+}
+
+// processLine unwraps the line out of the container runtime format, if any,
+// and emits it, or hands it to the multiline aggregator when enabled. size is
+// the amount of bytes read for the line. It returns false if the processor has
+// been closed meanwhile
+func (lp *lineProcessor) processLine(l line, size int) bool {
+	if lp.decoder != nil {
+		return lp.decoder.add(l, size, lp.joinLine)
+	}
+	return lp.joinLine(l, size)
+}
+
+// joinLine emits the line, or hands it to the multiline aggregator when enabled
+func (lp *lineProcessor) joinLine(l line, size int) bool {
+	if lp.multiline == nil {
+		return lp.emit(l)
+	}
+	for _, message := range lp.multiline.add(l, size) {
+		if !lp.emit(message) {
+			return false
+		}
+	}
+	return true
+}
+
+// scheduleMultilineFlush makes sure a message being joined is sent when no
+// more lines arrive in time
+func (lp *lineProcessor) scheduleMultilineFlush() {
+	if lp.multiline == nil || !lp.multiline.hasPending() || lp.multiline.config.FlushTimeout <= 0 {
+		return
+	}
+	if lp.flushTimer == nil {
+		lp.flushTimer = time.AfterFunc(lp.multiline.config.FlushTimeout, lp.flushMultiline)
+	} else {
+		lp.flushTimer.Reset(lp.multiline.config.FlushTimeout)
+	}
+}
+
+func (lp *lineProcessor) flushMultiline() {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	if lp.multiline.hasPending() {
+		lp.emit(lp.multiline.flush())
+	}
+}
+
+// emit parses the message and sends it as an Entry if it is accepted. It
+// returns false if the processor has been closed meanwhile
+func (lp *lineProcessor) emit(message line) bool {
+	entry := Entry{
+		Folders:   lp.folders,
+		Message:   message.text,
+		Timestamp: time.Now(),
+		File:      lp.fpath,
+		Filename:  lp.file,
+		Hostname:  lp.hostname,
+		Truncated: message.truncated,
+		Labels:    lp.labels,
+	}
+	if !message.time.IsZero() {
+		readTime := entry.Timestamp
+		entry.ReadTime = &readTime
+		entry.Timestamp = message.time
+	}
+	if message.stream != "" {
+		entry.addFields(map[string]interface{}{"stream": message.stream})
+	}
+	// fields parsed out of the message take precedence over the ones of the path
+	entry.addFields(lp.pathFields)
+	if lp.parser != nil {
+		// on failure the raw message is sent
+		parsed := entry
+		if err := lp.parser(&parsed); err == nil {
+			entry = parsed
+		}
 	}
+	if lp.timestamp != nil {
+		// on failure the read time is kept
+		_ = lp.timestamp.extract(&entry)
+	}
+	level := detectLevel(entry)
+	entry.Level = level.String()
+	if level != LevelUnknown && level < lp.minLevel {
+		return true
+	}
+	filterValue := entry.Message
+	if lp.filterField != "" {
+		// entries without the field are filtered as if it was empty
+		filterValue, _ = entry.FieldValue(lp.filterField)
+	}
+	if !lp.acceptF(filterValue) {
+		return true
+	}
+	if lp.entryFilter != nil && !lp.entryFilter(entry) {
+		return true
+	}
+	if lp.redactor != nil && !lp.redactor.redact(&entry) {
+		return true
+	}
+	if lp.collapseTimeout > 0 {
+		if lp.last != nil && isRepeated(*lp.last, entry) {
+			lp.repeated++
+			lp.scheduleRepeatedReport()
+			return true
+		}
+		if !lp.reportRepeated() {
+			return false
+		}
+		lp.last = &entry
+	}
+	if !lp.allowRate() {
+		lp.suppressed++
+		lp.scheduleSuppressedReport()
+		return true
+	}
+	return lp.send(entry)
+}
+
+// isRepeated tells whether the entry repeats the last one: Same message, level
+// and fields, the latter including the ones parsed out of the message
+func isRepeated(last Entry, entry Entry) bool {
+	return last.Message == entry.Message && last.Level == entry.Level && reflect.DeepEqual(last.Fields, entry.Fields)
+}
+
+// allowRate tells whether an entry can be sent according to the rate limits
+func (lp *lineProcessor) allowRate() bool {
+	now := time.Now()
+	if lp.rateLimiter != nil && !lp.rateLimiter.allow(now) {
+		return false
+	}
+	return lp.globalRateLimiter == nil || lp.globalRateLimiter.allow(now)
+}
+
+// scheduleSuppressedReport makes sure the amount of entries suppressed by rate
+// limits is reported once the report interval elapses
+func (lp *lineProcessor) scheduleSuppressedReport() {
+	if lp.reportInterval <= 0 || lp.reportTimer != nil {
+		return
+	}
+	lp.reportTimer = time.AfterFunc(lp.reportInterval, lp.reportSuppressed)
+}
+
+// scheduleRepeatedReport makes sure the amount of times the last entry has
+// been repeated is reported when no different entry arrives in time
+func (lp *lineProcessor) scheduleRepeatedReport() {
+	if lp.collapseTimer != nil {
+		return
+	}
+	lp.collapseTimer = time.AfterFunc(lp.collapseTimeout, func() {
+		lp.mutex.Lock()
+		defer lp.mutex.Unlock()
+		lp.reportRepeated()
+	})
+}
+
+// reportRepeated sends an entry telling how many times the last entry has been
+// repeated since it was reported, if any. It returns false if the processor
+// has been closed meanwhile
+func (lp *lineProcessor) reportRepeated() bool {
+	if lp.collapseTimer != nil {
+		lp.collapseTimer.Stop()
+		lp.collapseTimer = nil
+	}
+	if lp.repeated == 0 {
+		return true
+	}
+	return lp.send(lp.repeatedEntry())
+}
+
+// repeatedEntry creates the entry reporting how many times the last entry has
+// been repeated and starts counting again
+func (lp *lineProcessor) repeatedEntry() Entry {
+	entry := lp.reportEntry(fmt.Sprintf("last message repeated %d times", lp.repeated), "repeated", lp.repeated)
+	entry.Level = lp.last.Level
+	lp.repeated = 0
+	return entry
+}
+
+// reportEntry creates an entry of the file reporting the value of a counter
+func (lp *lineProcessor) reportEntry(message string, counter string, value int) Entry {
+	return Entry{
+		Folders:   lp.folders,
+		Message:   message,
+		Timestamp: time.Now(),
+		File:      lp.fpath,
+		Filename:  lp.file,
+		Hostname:  lp.hostname,
+		Fields:    map[string]interface{}{counter: value},
+		Labels:    lp.labels,
+	}
+}
+
+// reportSuppressed sends an entry telling how many entries have been
+// suppressed by rate limits since the last report
+func (lp *lineProcessor) reportSuppressed() {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	lp.reportTimer = nil
+	if lp.suppressed == 0 {
+		return
+	}
+	entry := lp.reportEntry(fmt.Sprintf("%d lines suppressed by rate limits in the last %v", lp.suppressed, lp.reportInterval), "suppressed", lp.suppressed)
+	entry.Level = LevelWarn.String()
+	lp.suppressed = 0
+	lp.send(entry)
+}
+
+// send sends the entry. It returns false if the processor has been closed meanwhile
+func (lp *lineProcessor) send(entry Entry) bool {
+	select {
+	case lp.toEntryChan <- entry:
+		return true
+	case <-lp.done:
+		return false
+	}
+}
+
+// Flush processes any pending incomplete line as a whole line. It is used
+// when no more content is expected to complete it, e.g. on log rotation
+func (lp *lineProcessor) Flush() error {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+
+	if lp.discarding {
+		lp.pending = nil
+		lp.discarding = false
+	}
+	if len(lp.pending) > 0 {
+		l := line{text: string(bytes.TrimSuffix(lp.pending, []byte{'\r'}))}
+		size := len(lp.pending)
+		lp.pending = nil
+		if !lp.processLine(l, size) {
+			return io.ErrClosedPipe
+		}
+	}
+	if lp.decoder != nil && lp.decoder.hasPending() {
+		if !lp.decoder.flush(lp.joinLine) {
+			return io.ErrClosedPipe
+		}
+	}
+	if lp.multiline != nil && lp.multiline.hasPending() {
+		if !lp.emit(lp.multiline.flush()) {
+			return io.ErrClosedPipe
+		}
+	}
+	if !lp.reportRepeated() {
+		return io.ErrClosedPipe
+	}
+	return nil
+}
 
+// pendingLen returns the amount of bytes written that have not been sent yet,
+// either because they do not complete a line or because they are part of a
+// message being joined
+func (lp *lineProcessor) pendingLen() int {
+	lp.mutex.Lock()
+	defer lp.mutex.Unlock()
+	size := len(lp.pending)
+	if lp.decoder != nil {
+		size += lp.decoder.size
+	}
+	if lp.multiline != nil {
+		size += lp.multiline.size
+	}
+	return size
+}
+
+// closeReportTimeout is the time to wait for delivering the report of repeated
+// entries when the processor is closed, as nobody may be receiving entries anymore
+const closeReportTimeout = 100 * time.Millisecond
+
+// Close stops the processor. Any pending incomplete line or message being
+// joined is discarded, while the amount of times the last entry has been
+// repeated is still reported if it can be delivered in time
+func (lp *lineProcessor) Close() error {
+	lp.closeOnce.Do(func() {
+		// unblocks any entry being delivered, which holds the mutex
+		close(lp.done)
+		lp.mutex.Lock()
+		if lp.flushTimer != nil {
+			lp.flushTimer.Stop()
+		}
+		if lp.reportTimer != nil {
+			lp.reportTimer.Stop()
+		}
+		if lp.collapseTimer != nil {
+			lp.collapseTimer.Stop()
+		}
+		if lp.repeated > 0 {
+			select {
+			case lp.toEntryChan <- lp.repeatedEntry():
+			case <-time.After(closeReportTimeout):
+			}
+		}
+		lp.mutex.Unlock()
+	})
+	return nil
+}
+
+// DoTail starts following filename. Every new line written into the file is
+// sent to toEntryChan if it is accepted. initialScan tells whether the file has
+// been found at startup, which makes it be resumed from its checkpoint in the
+// registry, if any, or be followed from config.InitialStart. Otherwise, it is
+// followed from config.CreatedStart
+func DoTail(filename string, toEntryChan chan<- Entry, initialScan bool, config Config) (*Follower, error) {
 	if stat, err := os.Stat(filename); err == nil && !stat.IsDir() {
-		cmd := exec.Command("tail", "-f", "-n", "0", filename)
-		cmd.Stdout = prefixWriter
-		cmd.Stderr = prefixWriter
-		err := cmd.Start()
+		lineWriter, err := lineProcessorWriter(filename, toEntryChan, config)
 		if err != nil {
-			logger.Error.Printf("%v\n", err)
+			return nil, err
 		}
-		go func(c *exec.Cmd) {
-			err := cmd.Wait()
-			if err != nil {
-				logger.Warning.Printf("%s -> %v\n", filename, err)
-			}
-		}(cmd)
-		return cmd.Process, nil
+		start := config.CreatedStart
+		if initialScan {
+			start = config.InitialStart
+		}
+		follower, err := newFollower(filename, lineWriter, initialScan, start, config.Registry, config.AcceptRotation)
+		if err != nil {
+			lineWriter.Close()
+			return nil, err
+		}
+		go follower.run()
+		return follower, nil
 	}
 	logger.Warning.Printf("Trying to tail an non-existing file %s. Skipping.\n", filename)
 	return nil, nil
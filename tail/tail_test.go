@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"regexp"
 	"testing"
 	"time"
 )
@@ -20,7 +21,7 @@ var acceptF = func(string) bool { return true }
 func Example() {
 	chanOut := make(chan Entry)
 
-	writer, _ := lineProcessorWriter(Tag, chanOut, acceptF)
+	writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF})
 
 	go func() {
 		writer.Write([]byte(One))
@@ -56,7 +57,7 @@ func TestDoTail(t *testing.T) {
 	defer os.Remove(tmpfile.Name()) // clean up
 
 	chanOut := make(chan Entry)
-	tailProcess, _ := DoTail(tmpfile.Name(), chanOut, acceptF)
+	follower, _ := DoTail(tmpfile.Name(), chanOut, false, Config{Accept: acceptF})
 
 	time.Sleep(100 * time.Millisecond)
 	if _, err := tmpfile.Write(content); err != nil {
@@ -74,7 +75,70 @@ func TestDoTail(t *testing.T) {
 		t.Errorf("Found content %v is not expected; wanted %v", readContent, expectedContent)
 	}
 
-	if err := tailProcess.Kill(); err != nil {
-		t.Fatal(err)
+	follower.Stop()
+}
+
+func TestLongLinesAreTruncated(t *testing.T) {
+	chanOut := make(chan Entry)
+	writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF, MaxLineSize: 4})
+
+	go func() {
+		writer.Write([]byte("ab"))
+		writer.Write([]byte("c\n0123456789"))
+		writer.Write([]byte("abc\nnext\n"))
+	}()
+
+	for _, wanted := range []Entry{{Message: "abc", Truncated: false}, {Message: "0123", Truncated: true}, {Message: "next"}} {
+		select {
+		case e := <-chanOut:
+			if e.Message != wanted.Message || e.Truncated != wanted.Truncated {
+				t.Errorf("Found: %s (truncated %v); wanted: %s (truncated %v)", e.Message, e.Truncated, wanted.Message, wanted.Truncated)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %s", wanted.Message)
+		}
+	}
+}
+
+func TestLongLinesAreSplit(t *testing.T) {
+	chanOut := make(chan Entry)
+	writer, _ := lineProcessorWriter(Tag, chanOut, Config{Accept: acceptF, MaxLineSize: 4, SplitLongLines: true})
+
+	// multi-byte characters are not broken
+	go writer.Write([]byte("0123456789\nabcñe\n"))
+
+	for _, wanted := range []string{"0123", "4567", "89", "abc", "ñe"} {
+		select {
+		case e := <-chanOut:
+			if e.Message != wanted || e.Truncated {
+				t.Errorf("Found: %s (truncated %v); wanted: %s", e.Message, e.Truncated, wanted)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %s", wanted)
+		}
+	}
+}
+
+func TestPathFields(t *testing.T) {
+	chanOut := make(chan Entry)
+	pattern := regexp.MustCompile(`/logs/(?P<service>[^/]+)/(?P<instance>[^/]+)/[^/]*\.log$`)
+	writer, _ := lineProcessorWriter("/var/logs/api/i-1/app.log", chanOut, Config{Accept: acceptF, PathPattern: pattern, Parser: LogfmtParser("msg")})
+
+	go writer.Write([]byte("msg=one\nmsg=two instance=i-2\n"))
+
+	wanted := []map[string]interface{}{{"service": "api", "instance": "i-1"}, {"service": "api", "instance": "i-2"}}
+	for _, fields := range wanted {
+		select {
+		case e := <-chanOut:
+			if !reflect.DeepEqual(e.Fields, fields) {
+				t.Errorf("Found: %v; wanted: %v", e.Fields, fields)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout waiting for %v", fields)
+		}
+	}
+
+	if fields := pathFields("/var/other/app.log", pattern); fields != nil {
+		t.Errorf("Found: %v; wanted no fields", fields)
 	}
 }
@@ -0,0 +1,129 @@
+package tail
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timestampLayouts are the names that can be used instead of a layout
+var timestampLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"HTTPDate":    "02/Jan/2006:15:04:05 -0700",
+}
+
+const (
+	unixLayout   = "unix"
+	unixMsLayout = "unix_ms"
+)
+
+// Timestamp tells how to get the time of an entry out of its content
+type Timestamp struct {
+	// Field is the parsed field holding the timestamp
+	Field string
+	// Pattern finds the timestamp in the message when there is no Field. The
+	// first group is used if any, otherwise the whole match. When both Field
+	// and Pattern are missing, the timestamp is expected at the start of the message
+	Pattern *regexp.Regexp
+	// Layout is the go layout of the timestamp, the name of a predefined one,
+	// e.g. RFC3339, or either 'unix' or 'unix_ms' for epoch based timestamps
+	Layout string
+	// Location is the timezone of timestamps without one
+	Location *time.Location
+}
+
+// NewTimestamp creates a Timestamp. Layout names are replaced by their layout
+func NewTimestamp(field string, pattern *regexp.Regexp, layout string, location *time.Location) *Timestamp {
+	if predefined, ok := timestampLayouts[layout]; ok {
+		layout = predefined
+	}
+	if location == nil {
+		location = time.Local
+	}
+	return &Timestamp{Field: field, Pattern: pattern, Layout: layout, Location: location}
+}
+
+// extract sets the time of the entry from its content
+func (ts *Timestamp) extract(e *Entry) error {
+	value, err := ts.find(e)
+	if err != nil {
+		return err
+	}
+	t, err := ts.parse(value)
+	if err != nil {
+		return err
+	}
+	if e.ReadTime == nil {
+		readTime := e.Timestamp
+		e.ReadTime = &readTime
+	}
+	e.Timestamp = t
+	return nil
+}
+
+func (ts *Timestamp) find(e *Entry) (string, error) {
+	switch {
+	case ts.Field != "":
+		value, ok := e.FieldValue(ts.Field)
+		if !ok {
+			return "", errors.New("Entry has no timestamp field")
+		}
+		return value, nil
+	case ts.Pattern != nil:
+		matches := ts.Pattern.FindStringSubmatch(e.Message)
+		if matches == nil {
+			return "", errors.New("Message does not contain a timestamp")
+		}
+		if len(matches) > 1 {
+			return matches[1], nil
+		}
+		return matches[0], nil
+	default:
+		// take as many words from the message as the layout has
+		words := len(strings.Fields(ts.Layout))
+		messageWords := strings.Fields(e.Message)
+		if words == 0 || len(messageWords) < words {
+			return "", errors.New("Message does not start with a timestamp")
+		}
+		return strings.Join(messageWords[:words], " "), nil
+	}
+}
+
+func (ts *Timestamp) parse(value string) (time.Time, error) {
+	switch ts.Layout {
+	case unixLayout, unixMsLayout:
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if ts.Layout == unixMsLayout {
+			seconds /= 1000
+		}
+		whole := int64(seconds)
+		return time.Unix(whole, int64((seconds-float64(whole))*1e9)), nil
+	}
+	// the layout may need words to be separated by a single space
+	if strings.Count(ts.Layout, "  ") == 0 {
+		value = strings.Join(strings.Fields(value), " ")
+	}
+	t, err := time.ParseInLocation(ts.Layout, value, ts.Location)
+	if err != nil {
+		return t, err
+	}
+	if t.Year() == 0 {
+		// layouts without year, as in syslog, refer to the current one
+		t = t.AddDate(time.Now().In(ts.Location).Year(), 0, 0)
+	}
+	return t, nil
+}
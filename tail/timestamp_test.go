@@ -0,0 +1,75 @@
+package tail
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestTimestampAtMessageStart(t *testing.T) {
+	ts := NewTimestamp("", nil, "2006-01-02 15:04:05", time.UTC)
+	readTime := time.Now()
+	e := Entry{Message: "2019-05-05 20:26:59 started", Timestamp: readTime}
+	if err := ts.extract(&e); err != nil {
+		t.Fatal(err)
+	}
+	wanted := time.Date(2019, 5, 5, 20, 26, 59, 0, time.UTC)
+	if !e.Timestamp.Equal(wanted) {
+		t.Errorf("Found: %v; wanted: %v", e.Timestamp, wanted)
+	}
+	if e.ReadTime == nil || !e.ReadTime.Equal(readTime) {
+		t.Errorf("Found: %v; wanted: %v", e.ReadTime, readTime)
+	}
+}
+
+func TestTimestampWithPattern(t *testing.T) {
+	location, _ := time.LoadLocation("Europe/Madrid")
+	ts := NewTimestamp("", regexp.MustCompile(`\[(.+?)\]`), "HTTPDate", location)
+	e := Entry{Message: `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 2326`}
+	if err := ts.extract(&e); err != nil {
+		t.Fatal(err)
+	}
+	wanted := time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC)
+	if !e.Timestamp.Equal(wanted) {
+		t.Errorf("Found: %v; wanted: %v", e.Timestamp, wanted)
+	}
+}
+
+func TestTimestampFromFieldInLocation(t *testing.T) {
+	location, _ := time.LoadLocation("Europe/Madrid")
+	ts := NewTimestamp("ts", nil, "Stamp", location)
+	e := Entry{Fields: map[string]interface{}{"ts": "Oct  5 13:55:36"}}
+	if err := ts.extract(&e); err != nil {
+		t.Fatal(err)
+	}
+	wanted := time.Date(time.Now().In(location).Year(), 10, 5, 13, 55, 36, 0, location)
+	if !e.Timestamp.Equal(wanted) {
+		t.Errorf("Found: %v; wanted: %v", e.Timestamp, wanted)
+	}
+}
+
+func TestTimestampUnix(t *testing.T) {
+	for layout, value := range map[string]interface{}{"unix": "1557080819.5", "unix_ms": "1557080819500"} {
+		ts := NewTimestamp("ts", nil, layout, time.UTC)
+		e := Entry{Fields: map[string]interface{}{"ts": value}}
+		if err := ts.extract(&e); err != nil {
+			t.Fatal(err)
+		}
+		wanted := time.Unix(1557080819, 500000000)
+		if !e.Timestamp.Equal(wanted) {
+			t.Errorf("Found: %v; wanted: %v for %s", e.Timestamp, wanted, layout)
+		}
+	}
+}
+
+func TestTimestampNotFound(t *testing.T) {
+	ts := NewTimestamp("", nil, time.RFC3339, time.UTC)
+	readTime := time.Now()
+	e := Entry{Message: "no time here", Timestamp: readTime}
+	if err := ts.extract(&e); err == nil {
+		t.Error("Extracting a timestamp from a message without it should fail")
+	}
+	if !e.Timestamp.Equal(readTime) || e.ReadTime != nil {
+		t.Errorf("Found: %v %v; wanted: %v", e.Timestamp, e.ReadTime, readTime)
+	}
+}
@@ -10,12 +10,56 @@ import (
 	"sync"
 	"time"
 
+	"github.com/oscar-martin/tail_folders/checkpoint"
 	"github.com/oscar-martin/tail_folders/logger"
 	"github.com/oscar-martin/tail_folders/tail"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// FolderOptions tells which subfolders and files of the root folder are considered
+type FolderOptions struct {
+	// Recursive tells whether subfolders are watched
+	Recursive bool
+	// MaxDepth is the maximum amount of nested levels of subfolders watched.
+	// Zero means no limit
+	MaxDepth int
+	// ExcludeFolders matches the subfolders that are neither scanned nor
+	// watched, along with their subtrees. It is optional
+	ExcludeFolders PathPatterns
+	// IncludeHidden tells whether hidden subfolders are scanned and watched.
+	// Hidden files are always considered, while the folder where tail_folders
+	// writes its own log is always skipped
+	IncludeHidden bool
+	// FollowSymlinks tells whether symbolic links to folders are watched and
+	// files and folders reached through several paths are considered once.
+	// Otherwise, only symbolic links to files are tailed
+	FollowSymlinks bool
+	// ConfineToRoot tells whether symbolic links to targets out of the root
+	// folder are skipped when following them
+	ConfineToRoot bool
+	// Registry is shared with the watchers of other root folders, which may be
+	// nested or overlap, so every file is followed once. It is optional
+	Registry *RootRegistry
+}
+
+// fileKey identifies a file or folder by its device and inode or, when they
+// are not available, e.g. on windows, by its path with symbolic links resolved
+type fileKey struct {
+	device uint64
+	inode  uint64
+	path   string
+}
+
+// makeFileKey returns the key identifying the file or folder at filename
+func makeFileKey(filename string, fileInfo os.FileInfo) fileKey {
+	device, inode := checkpoint.FileID(fileInfo)
+	if device == 0 && inode == 0 {
+		return fileKey{path: resolveOrAbs(filename)}
+	}
+	return fileKey{device: device, inode: inode}
+}
+
 type rootFolderWatcher struct {
 	// mutex to protect shared resources from different goroutines
 	mutex sync.Mutex
@@ -23,99 +67,263 @@ type rootFolderWatcher struct {
 	root string
 	// exitChans contains the channel that exits processing goroutines for watcher events
 	exitChans map[string]chan<- struct{}
-	// tailProcesses contains the tail process that are running per folder
-	tailProcesses map[string]map[string]*os.Process
+	// followers contains the file followers that are running per folder
+	followers map[string]map[string]*tail.Follower
 	// watchers contains the watcher instance per subfolder
 	watchers map[string]*fsnotify.Watcher
 	// toStsdOutChan is the channel to use for outputing the tail information from files
-	toStdOutChan      chan<- tail.Entry
-	recursive         bool
-	filterFunc        func(string) bool
-	contentFilterFunc func(string) bool
-	timeout           int
-	oldFiles          int
+	toStdOutChan  chan<- tail.Entry
+	folderOptions FolderOptions
+	// resolvedRoot is the root folder with its symbolic links resolved
+	resolvedRoot string
+	// claimed contains the path through which every file and folder is
+	// considered, by device and inode. It has its own mutex, as followers claim
+	// files on rotation while the mutex may be held waiting for them to stop
+	claimed      map[fileKey]string
+	claimedMutex sync.Mutex
+	// registryRoot is the root folder as it is known by the shared registry
+	registryRoot string
+	// filterFunc tells whether a file must be tailed out of its slash separated
+	// path relative to the root folder
+	filterFunc func(string) bool
+	tailConfig tail.Config
+	timeout    int
+	oldFiles   int
 }
 
 // MakeRootFolderWatcher lets you create a rootFolderWatcher instance
-func MakeRootFolderWatcher(root string, toStdOutChan chan<- tail.Entry, recursive bool, filterFunc func(string) bool, contentFilterFunc func(string) bool, timeout, oldFiles int) *rootFolderWatcher {
-	return &rootFolderWatcher{
-		root:              root,
-		exitChans:         make(map[string]chan<- struct{}),
-		tailProcesses:     make(map[string]map[string]*os.Process),
-		watchers:          make(map[string]*fsnotify.Watcher),
-		toStdOutChan:      toStdOutChan,
-		recursive:         recursive,
-		filterFunc:        filterFunc,
-		contentFilterFunc: contentFilterFunc,
-		timeout:           timeout,
-		oldFiles:          oldFiles,
+func MakeRootFolderWatcher(root string, toStdOutChan chan<- tail.Entry, folderOptions FolderOptions, filterFunc func(string) bool, tailConfig tail.Config, timeout, oldFiles int) *rootFolderWatcher {
+	r := &rootFolderWatcher{
+		root:          root,
+		exitChans:     make(map[string]chan<- struct{}),
+		claimed:       make(map[fileKey]string),
+		followers:     make(map[string]map[string]*tail.Follower),
+		watchers:      make(map[string]*fsnotify.Watcher),
+		toStdOutChan:  toStdOutChan,
+		folderOptions: folderOptions,
+		filterFunc:    filterFunc,
+		tailConfig:    tailConfig,
+		timeout:       timeout,
+		oldFiles:      oldFiles,
 	}
+	// followers check the file found on rotation is not followed through another path
+	r.tailConfig.AcceptRotation = r.reclaim
+	return r
 }
 
-func (r *rootFolderWatcher) scanAndAddSubfolder(folderPath string, dataChan chan<- tail.Entry) error {
+// scanAndAddSubfolder processes the content of folderPath. initialScan tells
+// whether the folder is being scanned at startup or it has been created later
+func (r *rootFolderWatcher) scanAndAddSubfolder(folderPath string, dataChan chan<- tail.Entry, initialScan bool) error {
 	files, err := ioutil.ReadDir(folderPath)
 	if err != nil {
 		return err
 	}
 	for _, fileInfo := range files {
 		filename := path.Join(folderPath, fileInfo.Name())
-		r.processExistingFileInfo(folderPath, fileInfo, filename, dataChan)
+		r.processExistingFileInfo(folderPath, fileInfo, filename, dataChan, initialScan)
 	}
 
 	return nil
 }
 
-func (r *rootFolderWatcher) processExistingFileInfo(folder string, fileInfo os.FileInfo, filename string, dataChan chan<- tail.Entry) {
-	if fileInfo.IsDir() && !isHidden(filename) && r.recursive {
-		err := r.watch(filename)
+func (r *rootFolderWatcher) processExistingFileInfo(folder string, fileInfo os.FileInfo, filename string, dataChan chan<- tail.Entry, initialScan bool) {
+	if fileInfo.Mode()&os.ModeSymlink != 0 {
+		targetInfo, ok := r.resolveSymlink(filename)
+		if !ok {
+			return
+		}
+		fileInfo = targetInfo
+	}
+	if fileInfo.IsDir() {
+		if !r.isWatchable(filename) || !r.claim(filename, fileInfo) {
+			return
+		}
+		err := r.watch(filename, initialScan)
 		if err != nil {
 			logger.Error.Printf("Error trying to watch folder path '%s': %v. Skipping...", folder, err)
 			return
 		}
 	} else {
-		if r.filterFunc(fileInfo.Name()) {
+		if r.filterFunc(r.relativePath(filename)) {
+			if r.notifyFollower(folder, filename) {
+				// already tailing it. The file has been created again after a rotation
+				// and the follower takes care of switching to it
+				return
+			}
+			if !r.claim(filename, fileInfo) {
+				return
+			}
 			modTime := fileInfo.ModTime()
 			diff := time.Now().Sub(modTime)
 			if r.oldFiles > 0 && diff.Seconds() > float64(r.oldFiles) {
 				logger.Info.Printf("Discarding tailing file '%s' because it is too old\n", filename)
+				r.release(filename)
+				return
+			}
+			registry := r.folderOptions.Registry
+			if registry != nil && !registry.acquire(r.registryRoot, filename) {
+				r.release(filename)
 				return
 			}
 
-			process, err := tail.DoTail(filename, dataChan, r.contentFilterFunc)
+			// files found at startup are resumed from their checkpoint, if any, and
+			// the rest are started from the configured position
+			follower, err := tail.DoTail(filename, dataChan, initialScan, r.tailConfig)
 			if err != nil {
 				logger.Error.Printf("Error trying to tail file '%s': %v", filename, err)
+				r.release(filename)
 				return
 			}
 			logger.Info.Printf("Started tailing '%s'\n", filename)
-			if process != nil {
+			if follower != nil {
 				r.mutex.Lock()
-				if _, ok := r.tailProcesses[folder]; !ok {
-					r.tailProcesses[folder] = make(map[string]*os.Process)
+				if _, ok := r.followers[folder]; !ok {
+					r.followers[folder] = make(map[string]*tail.Follower)
 				}
-				r.tailProcesses[folder][filename] = process
+				r.followers[folder][filename] = follower
 				r.mutex.Unlock()
+			} else {
+				r.release(filename)
 			}
 		}
 	}
 }
 
+// resolveSymlink returns the info of the target of the symbolic link, or false
+// if it must be skipped
+func (r *rootFolderWatcher) resolveSymlink(filename string) (os.FileInfo, bool) {
+	targetInfo, err := os.Stat(filename)
+	if err != nil {
+		logger.Warning.Printf("Skipping symbolic link '%s': %v\n", filename, err)
+		return nil, false
+	}
+	if !r.folderOptions.FollowSymlinks {
+		// links to files have always been tailed
+		return targetInfo, !targetInfo.IsDir()
+	}
+	if r.folderOptions.ConfineToRoot {
+		target, err := resolvePath(filename)
+		if err != nil {
+			logger.Warning.Printf("Skipping symbolic link '%s': %v\n", filename, err)
+			return nil, false
+		}
+		if !isWithin(r.resolvedRoot, target) {
+			logger.Warning.Printf("Skipping symbolic link '%s' because its target '%s' is out of '%s'\n", filename, target, r.root)
+			return nil, false
+		}
+	}
+	return targetInfo, true
+}
+
+// claim tells whether the file or folder must be considered through this path.
+// Files and folders reached through several paths, e.g. because of symbolic
+// link loops or of a rotated file renamed to a name matching the filters, are
+// only considered through the first one
+func (r *rootFolderWatcher) claim(filename string, fileInfo os.FileInfo) bool {
+	key := makeFileKey(filename, fileInfo)
+	r.claimedMutex.Lock()
+	defer r.claimedMutex.Unlock()
+	if claimer, ok := r.claimed[key]; ok && claimer != filename {
+		logger.Info.Printf("Skipping '%s' because it is already considered as '%s'\n", filename, claimer)
+		return false
+	}
+	r.claimed[key] = filename
+	return true
+}
+
+// reclaim tells whether the follower of filename can switch to the file found
+// at that path on rotation, which may be a different one when filename is or
+// goes through a symbolic link that has been retargeted
+func (r *rootFolderWatcher) reclaim(filename string, fileInfo os.FileInfo) bool {
+	r.release(filename)
+	if !r.claim(filename, fileInfo) {
+		return false
+	}
+	if r.folderOptions.Registry != nil && !r.folderOptions.Registry.acquire(r.registryRoot, filename) {
+		r.release(filename)
+		return false
+	}
+	return true
+}
+
+// release lets the file or folder at filename be considered through another path
+func (r *rootFolderWatcher) release(filename string) {
+	r.claimedMutex.Lock()
+	for key, claimer := range r.claimed {
+		if claimer == filename {
+			delete(r.claimed, key)
+		}
+	}
+	r.claimedMutex.Unlock()
+	if r.folderOptions.Registry != nil {
+		r.folderOptions.Registry.release(r.registryRoot, filename)
+	}
+}
+
+// isWatchable tells whether the subfolder must be scanned and watched
+func (r *rootFolderWatcher) isWatchable(folder string) bool {
+	if !r.folderOptions.Recursive || filepath.Base(folder) == logger.FolderName {
+		return false
+	}
+	if isHidden(folder) && !r.folderOptions.IncludeHidden {
+		return false
+	}
+	relPath := r.relativePath(folder)
+	if r.folderOptions.MaxDepth > 0 && strings.Count(relPath, "/")+1 > r.folderOptions.MaxDepth {
+		return false
+	}
+	if r.folderOptions.ExcludeFolders.Match(relPath) {
+		logger.Info.Printf("Skipping excluded folder '%s'\n", folder)
+		return false
+	}
+	if r.folderOptions.Registry != nil && r.folderOptions.Registry.isOtherRoot(r.registryRoot, folder) {
+		logger.Info.Printf("Skipping folder '%s' because it is watched as a root folder\n", folder)
+		return false
+	}
+	return true
+}
+
+// relativePath returns the slash separated path of filename relative to the root folder
+func (r *rootFolderWatcher) relativePath(filename string) string {
+	relPath, err := filepath.Rel(r.root, filename)
+	if err != nil {
+		return filepath.ToSlash(filename)
+	}
+	return filepath.ToSlash(relPath)
+}
+
 func (r *rootFolderWatcher) processDeletedFile(folder string, name string) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	if processes, ok := r.tailProcesses[folder]; ok {
-		if process, ok := processes[name]; ok {
-			err := process.Kill()
-			if err != nil {
-				logger.Error.Printf("Forced removing tail process on '%s' (file is removed) with error %v\n", folder, err)
-			} else {
-				logger.Info.Printf("Forced removing tail process on '%s' because file has been removed\n", folder)
+	if followers, ok := r.followers[folder]; ok {
+		if follower, ok := followers[name]; ok {
+			follower.Stop()
+			delete(followers, name)
+			r.release(name)
+			logger.Info.Printf("Stopped tailing '%s' because file has been removed\n", name)
+			if r.tailConfig.Registry != nil {
+				r.tailConfig.Registry.Remove(name)
 			}
 		} else {
-			logger.Warning.Printf("tail process for '%s' is not found\n", name)
+			logger.Warning.Printf("tail follower for '%s' is not found\n", name)
 		}
 	}
 }
 
+// notifyFollower lets the follower of a file know about changes on it. It
+// returns whether the file is being followed
+func (r *rootFolderWatcher) notifyFollower(folder string, name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if followers, ok := r.followers[folder]; ok {
+		if follower, ok := followers[name]; ok {
+			follower.Notify()
+			return true
+		}
+	}
+	return false
+}
+
 func (r *rootFolderWatcher) Close() {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
@@ -128,6 +336,39 @@ func (r *rootFolderWatcher) Close() {
 		logger.Info.Printf("Processor on folder '%s' terminated\n", folder)
 		close(exitChan)
 	}
+
+	for folder, followers := range r.followers {
+		for _, follower := range followers {
+			follower.Stop()
+		}
+		delete(r.followers, folder)
+		logger.Info.Printf("Stopped tailing files on folder '%s'\n", folder)
+	}
+}
+
+// isWatched tells whether there is a watcher for the subfolder
+func (r *rootFolderWatcher) isWatched(folder string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, ok := r.watchers[folder]
+	return ok
+}
+
+// unwatchTree unwatches the subfolder along with the subfolders watched below
+// it, which is needed when it has been removed, renamed or replaced, as events
+// are not received for its content when it is a symbolic link
+func (r *rootFolderWatcher) unwatchTree(folder string) {
+	folders := []string{}
+	r.mutex.Lock()
+	for watched := range r.watchers {
+		if watched == folder || strings.HasPrefix(watched, folder+string(filepath.Separator)) {
+			folders = append(folders, watched)
+		}
+	}
+	r.mutex.Unlock()
+	for _, watched := range folders {
+		r.unwatch(watched)
+	}
 }
 
 func (r *rootFolderWatcher) unwatch(folder string) {
@@ -145,20 +386,19 @@ func (r *rootFolderWatcher) unwatch(folder string) {
 			delete(r.exitChans, folder)
 			logger.Info.Printf("Closing processor for events in folder '%s'\n", folder)
 		}
+		r.release(folder)
 	}
-	if processes, ok := r.tailProcesses[folder]; ok {
-		for _, process := range processes {
-			err := process.Kill()
-			if err != nil {
-				logger.Error.Printf("Forced removing tail process on '%s' (file is removed) with error %v\n", folder, err)
-			} else {
-				logger.Info.Printf("Forced removing tail process on '%s' because file has been removed\n", folder)
-			}
+	if followers, ok := r.followers[folder]; ok {
+		for name, follower := range followers {
+			follower.Stop()
+			r.release(name)
 		}
+		delete(r.followers, folder)
+		logger.Info.Printf("Stopped tailing files on folder '%s'\n", folder)
 	}
 }
 
-func (r *rootFolderWatcher) watch(folder string) error {
+func (r *rootFolderWatcher) watch(folder string, initialScan bool) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return err
@@ -168,7 +408,7 @@ func (r *rootFolderWatcher) watch(folder string) error {
 	dataChan := make(chan tail.Entry)
 	activityChan := make(chan struct{})
 
-	err = r.scanAndAddSubfolder(folder, dataChan)
+	err = r.scanAndAddSubfolder(folder, dataChan, initialScan)
 	if err != nil {
 		close(dataChan)
 		close(activityChan)
@@ -207,22 +447,39 @@ func (r *rootFolderWatcher) watch(folder string) error {
 	go func() {
 		for {
 			select {
-			case event := <-watcher.Events:
+			case event, ok := <-watcher.Events:
+				if !ok {
+					// watcher has been closed
+					return
+				}
 				// fmt.Printf("%v \n", event)
+				// event names are cleaned so they match the paths used while scanning folders
+				name := filepath.Clean(event.Name)
 				if event.Op&fsnotify.Create == fsnotify.Create {
-					fileInfo, err := os.Stat(event.Name)
+					if name != folder && r.isWatched(name) {
+						// a symbolic link to a folder has been replaced
+						r.unwatchTree(name)
+					}
+					fileInfo, err := os.Lstat(name)
 					if err != nil {
-						logger.Error.Printf("Unable to stat file '%s': %v", event.Name, err)
+						logger.Error.Printf("Unable to stat file '%s': %v", name, err)
 					} else {
-						r.processExistingFileInfo(folder, fileInfo, event.Name, dataChan)
+						r.processExistingFileInfo(folder, fileInfo, name, dataChan, false)
 					}
 				} else if event.Op&fsnotify.Remove == fsnotify.Remove {
 					// fmt.Printf("%v \n", event)
-					if folder == event.Name {
+					if folder == name {
 						r.unwatch(folder)
+					} else if r.isWatched(name) {
+						r.unwatchTree(name)
 					} else {
-						r.processDeletedFile(folder, event.Name)
+						r.processDeletedFile(folder, name)
 					}
+				} else if event.Op&fsnotify.Rename == fsnotify.Rename && name != folder && r.isWatched(name) {
+					r.unwatchTree(name)
+				} else if event.Op&(fsnotify.Write|fsnotify.Rename) != 0 {
+					// renamed files are kept being read till a new one is created in their place
+					r.notifyFollower(folder, name)
 				}
 			case err := <-watcher.Errors:
 				if err != nil {
@@ -263,7 +520,33 @@ func (r *rootFolderWatcher) watch(folder string) error {
 }
 
 func (r *rootFolderWatcher) Watch() error {
-	return r.watch(r.root)
+	if r.folderOptions.Registry != nil {
+		r.registryRoot = resolveOrAbs(r.root)
+		if !r.folderOptions.Registry.watchRoot(r.registryRoot) {
+			logger.Warning.Printf("Skipping root folder '%s' because it is already watched\n", r.root)
+			return nil
+		}
+	}
+	if r.folderOptions.FollowSymlinks {
+		resolvedRoot, err := resolvePath(r.root)
+		if err != nil {
+			return err
+		}
+		r.resolvedRoot = resolvedRoot
+		if rootInfo, err := os.Stat(r.root); err == nil {
+			r.claim(r.root, rootInfo)
+		}
+	}
+	return r.watch(r.root, true)
+}
+
+// resolvePath returns the absolute path of filename with its symbolic links resolved
+func resolvePath(filename string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(filename)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
 }
 
 func isHidden(filename string) bool {
@@ -0,0 +1,253 @@
+package watcher
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/oscar-martin/tail_folders/tail"
+)
+
+func TestIsWatchable(t *testing.T) {
+	excludes, _ := NewPathPatterns("glob", []string{"node_modules", "app/archive"})
+	r := MakeRootFolderWatcher("/logs", nil, FolderOptions{Recursive: true, MaxDepth: 2, ExcludeFolders: excludes}, nil, tail.Config{}, -1, -1)
+	tests := []struct {
+		folder string
+		wanted bool
+	}{
+		{"/logs/app", true},
+		{"/logs/app/v1", true},
+		{"/logs/app/v1/old", false},
+		{"/logs/node_modules", false},
+		{"/logs/app/node_modules", false},
+		{"/logs/app/archive", false},
+		{"/logs/web/archive", true},
+		{"/logs/.cache", false},
+	}
+	for _, test := range tests {
+		if found := r.isWatchable(test.folder); found != test.wanted {
+			t.Errorf("Found: %v; wanted: %v for %s", found, test.wanted, test.folder)
+		}
+	}
+
+	r.folderOptions.IncludeHidden = true
+	if !r.isWatchable("/logs/.pm2") || r.isWatchable("/logs/.logdir") {
+		t.Error("Hidden folders but the log one should be watched when including hidden ones")
+	}
+
+	r.folderOptions.Recursive = false
+	if r.isWatchable("/logs/app") {
+		t.Error("Subfolders should not be watched when not recursive")
+	}
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	root, _ := ioutil.TempDir("", "tail_folders_root")
+	outside, _ := ioutil.TempDir("", "tail_folders_outside")
+	defer os.RemoveAll(root)
+	defer os.RemoveAll(outside)
+	_ = os.MkdirAll(filepath.Join(root, "releases", "123"), os.ModePerm)
+	_ = ioutil.WriteFile(filepath.Join(root, "releases", "123", "app.log"), nil, 0644)
+	_ = ioutil.WriteFile(filepath.Join(outside, "other.log"), nil, 0644)
+	_ = os.Symlink(filepath.Join("releases", "123"), filepath.Join(root, "current"))
+	_ = os.Symlink(".", filepath.Join(root, "loop"))
+	_ = os.Symlink(outside, filepath.Join(root, "outside"))
+
+	tests := []struct {
+		options FolderOptions
+		wanted  []string
+	}{
+		{FolderOptions{Recursive: true}, []string{"releases/123/app.log"}},
+		{FolderOptions{Recursive: true, FollowSymlinks: true}, []string{"current/app.log", "outside/other.log"}},
+		{FolderOptions{Recursive: true, FollowSymlinks: true, ConfineToRoot: true}, []string{"current/app.log"}},
+	}
+	for _, test := range tests {
+		r := MakeRootFolderWatcher(root, nil, test.options, func(string) bool { return true }, tail.Config{}, -1, -1)
+		if err := r.Watch(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		found := []string{}
+		r.mutex.Lock()
+		for _, followers := range r.followers {
+			for filename := range followers {
+				found = append(found, r.relativePath(filename))
+			}
+		}
+		r.mutex.Unlock()
+		r.Close()
+		sort.Strings(found)
+		if !reflect.DeepEqual(found, test.wanted) {
+			t.Errorf("Found: %v; wanted: %v with %+v", found, test.wanted, test.options)
+		}
+	}
+}
+
+func TestNestedRoots(t *testing.T) {
+	outer, _ := ioutil.TempDir("", "tail_folders_root")
+	defer os.RemoveAll(outer)
+	inner := filepath.Join(outer, "app")
+	_ = os.MkdirAll(filepath.Join(inner, "v1"), os.ModePerm)
+	_ = ioutil.WriteFile(filepath.Join(outer, "outer.log"), nil, 0644)
+	_ = ioutil.WriteFile(filepath.Join(inner, "inner.log"), nil, 0644)
+	_ = ioutil.WriteFile(filepath.Join(inner, "v1", "deep.log"), nil, 0644)
+	_ = os.Symlink(inner, filepath.Join(outer, "current"))
+
+	roots := []string{outer, inner, outer + "/"}
+	registry := NewRootRegistry(roots)
+	options := FolderOptions{Recursive: true, FollowSymlinks: true, Registry: registry}
+	wanted := [][]string{{"outer.log"}, {"inner.log", "v1/deep.log"}, {}}
+	for i, root := range roots {
+		r := MakeRootFolderWatcher(root, nil, options, func(string) bool { return true }, tail.Config{}, -1, -1)
+		if err := r.Watch(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer r.Close()
+		found := []string{}
+		r.mutex.Lock()
+		for _, followers := range r.followers {
+			for filename := range followers {
+				found = append(found, r.relativePath(filename))
+			}
+		}
+		r.mutex.Unlock()
+		sort.Strings(found)
+		if !reflect.DeepEqual(found, wanted[i]) {
+			t.Errorf("Found: %v; wanted: %v for root %s", found, wanted[i], root)
+		}
+	}
+}
+
+func TestHiddenFiles(t *testing.T) {
+	root, _ := ioutil.TempDir("", "tail_folders_root")
+	defer os.RemoveAll(root)
+	_ = os.MkdirAll(filepath.Join(root, ".cache"), os.ModePerm)
+	_ = ioutil.WriteFile(filepath.Join(root, ".app.log"), nil, 0644)
+	_ = ioutil.WriteFile(filepath.Join(root, ".cache", "app.log"), nil, 0644)
+
+	// hidden files are tailed even when hidden folders are skipped
+	r := MakeRootFolderWatcher(root, nil, FolderOptions{Recursive: true}, func(string) bool { return true }, tail.Config{}, -1, -1)
+	if err := r.Watch(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer r.Close()
+	found := []string{}
+	r.mutex.Lock()
+	for _, followers := range r.followers {
+		for filename := range followers {
+			found = append(found, r.relativePath(filename))
+		}
+	}
+	r.mutex.Unlock()
+	if wanted := []string{".app.log"}; !reflect.DeepEqual(found, wanted) {
+		t.Errorf("Found: %v; wanted: %v", found, wanted)
+	}
+}
+
+func TestRetargetSymlink(t *testing.T) {
+	root, _ := ioutil.TempDir("", "tail_folders_root")
+	defer os.RemoveAll(root)
+	_ = os.MkdirAll(filepath.Join(root, "releases", "123"), os.ModePerm)
+	_ = ioutil.WriteFile(filepath.Join(root, "releases", "123", "app.log"), nil, 0644)
+	_ = os.Symlink(filepath.Join("releases", "123"), filepath.Join(root, "current"))
+
+	entries := make(chan tail.Entry, 10)
+	config := tail.Config{Accept: func(string) bool { return true }}
+	r := MakeRootFolderWatcher(root, entries, FolderOptions{Recursive: true, FollowSymlinks: true}, func(string) bool { return true }, config, -1, -1)
+	if err := r.Watch(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer r.Close()
+
+	// deploy a new release and swap the link atomically
+	_ = os.MkdirAll(filepath.Join(root, "releases", "124"), os.ModePerm)
+	time.Sleep(100 * time.Millisecond)
+	_ = ioutil.WriteFile(filepath.Join(root, "releases", "124", "app.log"), nil, 0644)
+	_ = os.Symlink(filepath.Join("releases", "124"), filepath.Join(root, "current.tmp"))
+	_ = os.Rename(filepath.Join(root, "current.tmp"), filepath.Join(root, "current"))
+	time.Sleep(100 * time.Millisecond)
+
+	file, _ := os.OpenFile(filepath.Join(root, "releases", "124", "app.log"), os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = file.Write([]byte("deployed\n"))
+	file.Close()
+
+	found := []string{}
+	timeout := time.After(2 * time.Second)
+	for done := false; !done; {
+		select {
+		case e := <-entries:
+			found = append(found, r.relativePath(e.File))
+		case <-timeout:
+			done = true
+		}
+	}
+	if wanted := []string{"releases/124/app.log"}; !reflect.DeepEqual(found, wanted) {
+		t.Errorf("Found: %v; wanted: %v", found, wanted)
+	}
+}
+
+func TestRotatedNameMatchingFilters(t *testing.T) {
+	root, _ := ioutil.TempDir("", "tail_folders_root")
+	defer os.RemoveAll(root)
+	path := filepath.Join(root, "app.log")
+	_ = ioutil.WriteFile(path, nil, 0644)
+
+	created, _ := tail.ParseStartPosition("beginning")
+	entries := make(chan tail.Entry, 10)
+	config := tail.Config{Accept: func(string) bool { return true }, CreatedStart: created}
+	r := MakeRootFolderWatcher(root, entries, FolderOptions{}, func(string) bool { return true }, config, -1, -1)
+	if err := r.Watch(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer r.Close()
+
+	// the rotated file keeps being read by the follower of app.log only
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	defer file.Close()
+	_, _ = file.Write([]byte("line1\n"))
+	_ = os.Rename(path, filepath.Join(root, "app.1.log"))
+	time.Sleep(100 * time.Millisecond)
+	_, _ = file.Write([]byte("line2\n"))
+
+	found := []string{}
+	timeout := time.After(2 * time.Second)
+	for done := false; !done; {
+		select {
+		case e := <-entries:
+			found = append(found, r.relativePath(e.File)+" "+e.Message)
+		case <-timeout:
+			done = true
+		}
+	}
+	if wanted := []string{"app.log line1", "app.log line2"}; !reflect.DeepEqual(found, wanted) {
+		t.Errorf("Found: %v; wanted: %v", found, wanted)
+	}
+}
+
+// noInodeInfo hides the device and inode of a file, as on windows
+type noInodeInfo struct {
+	os.FileInfo
+}
+
+func (noInodeInfo) Sys() interface{} {
+	return nil
+}
+
+func TestClaimWithoutInode(t *testing.T) {
+	root, _ := ioutil.TempDir("", "tail_folders_root")
+	defer os.RemoveAll(root)
+	_ = os.Symlink(".", filepath.Join(root, "loop"))
+	rootInfo, _ := os.Stat(root)
+
+	// folders reached through a loop are told apart by their resolved path
+	r := MakeRootFolderWatcher(root, nil, FolderOptions{Recursive: true, FollowSymlinks: true}, func(string) bool { return true }, tail.Config{}, -1, -1)
+	if !r.claim(root, noInodeInfo{rootInfo}) {
+		t.Error("Root folder should be claimed")
+	}
+	if r.claim(filepath.Join(root, "loop"), noInodeInfo{rootInfo}) {
+		t.Error("Link to the root folder should not be claimed")
+	}
+}
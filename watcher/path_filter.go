@@ -0,0 +1,132 @@
+package watcher
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pathPattern matches the path of files relative to the root folder. Patterns
+// without any slash match the base name of files only
+type pathPattern struct {
+	regex    *regexp.Regexp
+	baseName bool
+}
+
+func (p pathPattern) match(relPath string) bool {
+	if p.baseName {
+		return p.regex.MatchString(path.Base(relPath))
+	}
+	return p.regex.MatchString(relPath)
+}
+
+// PathPatterns matches paths relative to the root folder against several patterns
+type PathPatterns []pathPattern
+
+// NewPathPatterns compiles patterns of the given type: Either 'glob' or
+// 'regex'. Globs support '**' for matching any amount of folders
+func NewPathPatterns(expressionType string, patterns []string) (PathPatterns, error) {
+	var compile func(string) (*regexp.Regexp, error)
+	switch expressionType {
+	case "glob":
+		compile = globToRegexp
+	case "regex":
+		compile = regexp.Compile
+	default:
+		return nil, fmt.Errorf("Unrecognized filter_by value: %s", expressionType)
+	}
+
+	compiled := PathPatterns{}
+	for _, pattern := range patterns {
+		regex, err := compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("Expression '%s' is not right: %v", pattern, err)
+		}
+		compiled = append(compiled, pathPattern{regex: regex, baseName: !strings.Contains(pattern, "/")})
+	}
+	return compiled, nil
+}
+
+// Match tells whether relPath, a slash separated path relative to the root
+// folder, matches any of the patterns
+func (p PathPatterns) Match(relPath string) bool {
+	for _, pattern := range p {
+		if pattern.match(relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// PathFilter tells whether files must be tailed out of their path relative to
+// the root folder. A file is tailed when it matches any of the include
+// patterns and none of the exclude ones
+type PathFilter struct {
+	includes PathPatterns
+	excludes PathPatterns
+}
+
+// NewPathFilter creates a PathFilter out of patterns of the given type, as NewPathPatterns does
+func NewPathFilter(expressionType string, includes []string, excludes []string) (*PathFilter, error) {
+	includePatterns, err := NewPathPatterns(expressionType, includes)
+	if err != nil {
+		return nil, err
+	}
+	excludePatterns, err := NewPathPatterns(expressionType, excludes)
+	if err != nil {
+		return nil, err
+	}
+	return &PathFilter{includes: includePatterns, excludes: excludePatterns}, nil
+}
+
+// Match tells whether the file at relPath, a slash separated path relative to
+// the root folder, must be tailed
+func (f *PathFilter) Match(relPath string) bool {
+	return f.includes.Match(relPath) && !f.excludes.Match(relPath)
+}
+
+// globToRegexp translates a glob into a regex. Besides the syntax of
+// filepath.Match, '**' matches any amount of folders when it is a whole path
+// segment, e.g. '**/app/*.log' or 'logs/**'
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/") && (i == 0 || glob[i-1] == '/'):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case glob[i:] == "**" && i > 0 && glob[i-1] == '/':
+			// the trailing slash has already been written
+			b.WriteString(".*")
+			i++
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated character class in '%s'", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			b.WriteString(regexp.QuoteMeta(glob[i+1 : i+2]))
+			i++
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
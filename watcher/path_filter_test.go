@@ -0,0 +1,84 @@
+package watcher
+
+import "testing"
+
+func TestPathFilterGlobs(t *testing.T) {
+	f, err := NewPathFilter("glob", []string{"**/app/*.log", "*.txt"}, []string{"**/archive/**", "debug-*"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tests := []struct {
+		path   string
+		wanted bool
+	}{
+		{"app/server.log", true},
+		{"eu/node1/app/server.log", true},
+		{"eu/app/nested/server.log", false},
+		{"app/archive/server.log", false},
+		{"archive/app/server.log", false},
+		{"app/debug-server.log", false},
+		{"notes.txt", true},
+		{"eu/notes.txt", true},
+		{"server.log", false},
+	}
+	for _, test := range tests {
+		if found := f.Match(test.path); found != test.wanted {
+			t.Errorf("Found: %v; wanted: %v for %s", found, test.wanted, test.path)
+		}
+	}
+}
+
+func TestPathFilterRegex(t *testing.T) {
+	f, err := NewPathFilter("regex", []string{`^file\d\.log$`, `^logs/.*\.log$`}, []string{`/tmp/`})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tests := []struct {
+		path   string
+		wanted bool
+	}{
+		{"file1.log", true},
+		{"sub/file1.log", true},
+		{"logs/a/b.log", true},
+		{"logs/tmp/b.log", false},
+		{"other/b.log", false},
+	}
+	for _, test := range tests {
+		if found := f.Match(test.path); found != test.wanted {
+			t.Errorf("Found: %v; wanted: %v for %s", found, test.wanted, test.path)
+		}
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob   string
+		path   string
+		wanted bool
+	}{
+		{"logs/**", "logs/a/b.log", true},
+		{"logs/**", "logsx/b.log", false},
+		{"a/**/b.log", "a/b.log", true},
+		{"a/**/b.log", "a/x/y/b.log", true},
+		{"file?.[!0-4]og", "file1.log", true},
+		{"file?.[!a-z]og", "file1.log", false},
+		{`\*.log`, "*.log", true},
+		{"*.log", "a/b.log", false},
+	}
+	for _, test := range tests {
+		regex, err := globToRegexp(test.glob)
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", test.glob, err)
+			continue
+		}
+		if found := regex.MatchString(test.path); found != test.wanted {
+			t.Errorf("Found: %v; wanted: %v for %s against %s (%s)", found, test.wanted, test.glob, test.path, regex)
+		}
+	}
+	if _, err := globToRegexp("file[.log"); err == nil {
+		t.Error("Glob 'file[.log' should be wrong")
+	}
+	if _, err := NewPathFilter("wildcard", []string{"*"}, nil); err == nil {
+		t.Error("Expression type 'wildcard' should be wrong")
+	}
+}
@@ -0,0 +1,127 @@
+package watcher
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/oscar-martin/tail_folders/logger"
+)
+
+// RootRegistry is shared by the watchers of several root folders, which may be
+// nested or overlap, so that every file is followed once, by the watcher of its
+// most specific root folder
+type RootRegistry struct {
+	mutex sync.Mutex
+	// roots are the root folders with their symbolic links resolved
+	roots []string
+	// watched contains the resolved root folders whose watcher is running
+	watched map[string]bool
+	// followed contains the watcher following every file, by resolved path
+	followed map[string]followedFile
+}
+
+// followedFile is a file followed by the watcher of root as filename
+type followedFile struct {
+	root     string
+	filename string
+}
+
+// NewRootRegistry returns a RootRegistry for the given root folders
+func NewRootRegistry(roots []string) *RootRegistry {
+	reg := &RootRegistry{
+		watched:  make(map[string]bool),
+		followed: make(map[string]followedFile),
+	}
+	for _, root := range roots {
+		reg.roots = append(reg.roots, resolveOrAbs(root))
+	}
+	return reg
+}
+
+// watchRoot tells whether the root folder must be watched, which is not the
+// case when it has already been given as another path
+func (reg *RootRegistry) watchRoot(root string) bool {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	if reg.watched[root] {
+		return false
+	}
+	reg.watched[root] = true
+	return true
+}
+
+// owner returns the most specific root folder holding the resolved path, if any
+func (reg *RootRegistry) owner(resolved string) (string, bool) {
+	owner := ""
+	for _, root := range reg.roots {
+		if isWithin(root, resolved) && len(root) > len(owner) {
+			owner = root
+		}
+	}
+	return owner, owner != ""
+}
+
+// isOtherRoot tells whether folder is a root folder other than root, so it is
+// watched by its own watcher
+func (reg *RootRegistry) isOtherRoot(root, folder string) bool {
+	resolved := resolveOrAbs(folder)
+	if resolved == root {
+		return false
+	}
+	for _, other := range reg.roots {
+		if other == resolved {
+			return true
+		}
+	}
+	return false
+}
+
+// acquire tells whether the watcher of root must follow filename, which is the
+// case when root is its most specific root folder and no other path to the same
+// file is being followed
+func (reg *RootRegistry) acquire(root, filename string) bool {
+	resolved := resolveOrAbs(filename)
+	if owner, ok := reg.owner(resolved); ok && owner != root {
+		logger.Info.Printf("Skipping '%s' because it belongs to root folder '%s'\n", filename, owner)
+		return false
+	}
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	if follower, ok := reg.followed[resolved]; ok && follower != (followedFile{root: root, filename: filename}) {
+		logger.Info.Printf("Skipping '%s' because it is already tailed as '%s'\n", filename, follower.filename)
+		return false
+	}
+	reg.followed[resolved] = followedFile{root: root, filename: filename}
+	return true
+}
+
+// release lets the file followed as filename by the watcher of root be followed
+// again
+func (reg *RootRegistry) release(root, filename string) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	for resolved, follower := range reg.followed {
+		if follower.root == root && follower.filename == filename {
+			delete(reg.followed, resolved)
+		}
+	}
+}
+
+// resolveOrAbs returns the absolute path of filename with its symbolic links
+// resolved, or just its absolute path when they cannot be resolved
+func resolveOrAbs(filename string) string {
+	if resolved, err := resolvePath(filename); err == nil {
+		return resolved
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filepath.Clean(filename)
+}
+
+// isWithin tells whether filename is folder or any path below it
+func isWithin(folder, filename string) bool {
+	relPath, err := filepath.Rel(folder, filename)
+	return err == nil && relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}